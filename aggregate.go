@@ -0,0 +1,114 @@
+package speicher
+
+type (
+	// Collection is implemented by every data store that holds elements of type T, like Map and List.
+	// The aggregation functions of this package, like Count and Sum, accept any Collection.
+	// They acquire the read lock of the Collection themselves, so don't call them while holding the write lock.
+	Collection[T any] interface {
+		// Find traverses the data store and returns the first element that satisfies the provided predicate function.
+		// If no element is found, the bool result will be false.
+		Find(func(T) bool) (value T, found bool)
+
+		// RLock acquires the read lock for the data store to allow safe reading.
+		// Don't forget to use RUnlock when you are done.
+		RLock()
+
+		// RUnlock releases the read lock for the data store.
+		RUnlock()
+	}
+
+	// number is the set of types Sum can add up.
+	number interface {
+		~int | ~int8 | ~int16 | ~int32 | ~int64 |
+			~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+			~float32 | ~float64
+	}
+)
+
+// each calls f for every element of s while holding the read lock.
+func each[T any](s Collection[T], f func(T)) {
+	s.RLock()
+	defer s.RUnlock()
+	s.Find(func(value T) bool {
+		f(value)
+		return false
+	})
+}
+
+// Count returns the number of elements in s that satisfy pred.
+func Count[T any](s Collection[T], pred func(T) bool) int {
+	n := 0
+	each(s, func(value T) {
+		if pred(value) {
+			n++
+		}
+	})
+	return n
+}
+
+// Sum adds up the numbers that f returns for the elements in s.
+func Sum[T any, N number](s Collection[T], f func(T) N) N {
+	var sum N
+	each(s, func(value T) {
+		sum += f(value)
+	})
+	return sum
+}
+
+// GroupBy groups the elements in s by the key that keyFunc returns for them.
+func GroupBy[T any, K comparable](s Collection[T], keyFunc func(T) K) map[K][]T {
+	groups := make(map[K][]T)
+	each(s, func(value T) {
+		key := keyFunc(value)
+		groups[key] = append(groups[key], value)
+	})
+	return groups
+}
+
+// Reduce combines the elements in s into a single value, starting with init.
+func Reduce[T any, A any](s Collection[T], init A, fn func(acc A, value T) A) A {
+	acc := init
+	each(s, func(value T) {
+		acc = fn(acc, value)
+	})
+	return acc
+}
+
+// MinBy returns the smallest element in s according to less.
+// If s is empty, the bool result will be false.
+func MinBy[T any](s Collection[T], less func(a, b T) bool) (smallest T, found bool) {
+	each(s, func(value T) {
+		if !found || less(value, smallest) {
+			smallest = value
+			found = true
+		}
+	})
+	return
+}
+
+// MaxBy returns the largest element in s according to less.
+// If s is empty, the bool result will be false.
+func MaxBy[T any](s Collection[T], less func(a, b T) bool) (largest T, found bool) {
+	each(s, func(value T) {
+		if !found || less(largest, value) {
+			largest = value
+			found = true
+		}
+	})
+	return
+}
+
+// Distinct returns the distinct keys that keyFunc returns for the elements in s, in the order they were first seen.
+func Distinct[T any, K comparable](s Collection[T], keyFunc func(T) K) []K {
+	seen := make(map[K]struct{})
+	var keys []K
+	each(s, func(value T) {
+		key := keyFunc(value)
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	})
+	return keys
+}
@@ -0,0 +1,193 @@
+package speicher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Blobs is a content-addressed store for large binary data, like file attachments.
+// Every blob is stored in its own file under the root directory and identified by the
+// hex encoded SHA-256 hash of its content, so storing the same content twice only keeps one copy.
+// Keep the IDs in the values of a Map instead of the data itself and register the Map with TrackBlobs,
+// so GC knows which blobs are still in use.
+// All methods are safe for concurrent use.
+type Blobs struct {
+	root    string
+	mut     sync.RWMutex
+	sources []func(count func(id string))
+}
+
+// OpenBlobs opens the blob store in the directory at root, creating the directory if necessary.
+func OpenBlobs(root string) (*Blobs, error) {
+	if err := os.MkdirAll(root, 0740); err != nil {
+		return nil, errors.Join(fmt.Errorf("unable to open blobs in '%s'", root), err)
+	}
+	return &Blobs{root: root}, nil
+}
+
+// validBlobID reports whether id looks like a hex encoded SHA-256 hash.
+// Only lowercase hex is valid, like the IDs returned by Put, because the ID is the path of the blob.
+func validBlobID(id string) bool {
+	if len(id) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Blobs) path(id string) string {
+	return filepath.Join(b.root, id[:2], id[2:])
+}
+
+// Put stores the content of r and returns its ID.
+func (b *Blobs) Put(r io.Reader) (string, error) {
+	f, err := os.CreateTemp(b.root, "put-*.tmp")
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("failed to create blob in '%s'", b.root), err)
+	}
+	defer os.Remove(f.Name())
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		_ = f.Close()
+		return "", errors.Join(fmt.Errorf("failed to write blob in '%s'", b.root), err)
+	}
+	if err := f.Close(); err != nil {
+		return "", errors.Join(fmt.Errorf("failed to write blob in '%s'", b.root), err)
+	}
+	id := hex.EncodeToString(h.Sum(nil))
+
+	// GC must not remove the blob between checking for it and renaming the new file.
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	location := b.path(id)
+	if _, err := os.Stat(location); err == nil {
+		// same content is already stored, mark it as fresh for GC
+		now := time.Now()
+		_ = os.Chtimes(location, now, now)
+		return id, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(location), 0740); err != nil {
+		return "", errors.Join(fmt.Errorf("failed to create blob '%s'", id), err)
+	}
+	if err := os.Rename(f.Name(), location); err != nil {
+		return "", errors.Join(fmt.Errorf("failed to create blob '%s'", id), err)
+	}
+	return id, nil
+}
+
+// Open returns a reader for the content of the blob with the given ID.
+// Don't forget to close it.
+func (b *Blobs) Open(id string) (io.ReadCloser, error) {
+	if !validBlobID(id) {
+		return nil, fmt.Errorf("invalid blob id '%s'", id)
+	}
+	f, err := os.Open(b.path(id))
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to open blob '%s'", id), err)
+	}
+	return f, nil
+}
+
+// Has checks if a blob with the given ID exists.
+func (b *Blobs) Has(id string) bool {
+	if !validBlobID(id) {
+		return false
+	}
+	_, err := os.Stat(b.path(id))
+	return err == nil
+}
+
+// TrackBlobs registers m as a user of the blobs in b.
+// refs returns the IDs of the blobs an element of m refers to.
+// RefCount and GC read m under its read lock, so don't call them while holding the write lock of m.
+func TrackBlobs[T any](b *Blobs, m Map[T], refs func(T) []string) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.sources = append(b.sources, func(count func(id string)) {
+		each(m, func(value T) {
+			for _, id := range refs(value) {
+				count(id)
+			}
+		})
+	})
+}
+
+// refCounts counts the references to every blob in all tracked maps.
+// It must be called without holding b.mut, because reading the maps waits for their locks,
+// and whoever holds them may be waiting in Put.
+func (b *Blobs) refCounts() map[string]int {
+	b.mut.RLock()
+	sources := b.sources
+	b.mut.RUnlock()
+
+	counts := make(map[string]int)
+	for _, source := range sources {
+		source(func(id string) {
+			counts[id]++
+		})
+	}
+	return counts
+}
+
+// RefCount returns the number of references to the blob with the given ID in all maps registered with TrackBlobs.
+func (b *Blobs) RefCount(id string) int {
+	return b.refCounts()[id]
+}
+
+// GC removes all blobs that are not referenced by any map registered with TrackBlobs
+// and were not stored within the grace period.
+// The grace period protects blobs that were just stored but are not referenced yet.
+// It returns the IDs of the removed blobs.
+func (b *Blobs) GC(grace time.Duration) ([]string, error) {
+	cutoff := time.Now().Add(-grace)
+	counts := b.refCounts()
+
+	// blobs stored while counting are younger than cutoff, so they are safe
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	var removed []string
+	var errs []error
+	err := filepath.WalkDir(b.root, func(location string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(b.root, location)
+		if err != nil {
+			return err
+		}
+		id := filepath.Dir(rel) + filepath.Base(rel)
+		if !validBlobID(id) || counts[id] > 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(location); err != nil {
+			errs = append(errs, errors.Join(fmt.Errorf("failed to remove blob '%s'", id), err))
+			return nil
+		}
+		removed = append(removed, id)
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, errors.Join(fmt.Errorf("failed to read blobs in '%s'", b.root), err))
+	}
+	return removed, errors.Join(errs...)
+}
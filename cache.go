@@ -0,0 +1,269 @@
+package speicher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type (
+	// memoryCache is a Cache implementation that keeps its entries in memory.
+	memoryCache[T any] struct {
+		entries *lru[T]
+		// sizes holds the size of every entry, only if maxBytes is set.
+		sizes      map[string]int64
+		bytes      int64
+		maxEntries int
+		maxBytes   int64
+		// loading holds the running loads of GetOrLoad by key.
+		loading  map[string]*cacheCall[T]
+		stats    CacheStats
+		location string
+		mut      sync.Mutex
+
+		saveState
+	}
+
+	// cacheCall is a running load of GetOrLoad.
+	// Concurrent misses of the same key wait for it instead of loading again.
+	cacheCall[T any] struct {
+		done  chan struct{}
+		value T
+		err   error
+		// stale is set if the key was changed while loading, so the result must not be stored.
+		stale bool
+	}
+
+	// cacheEntry is the persisted state of one entry.
+	cacheEntry[T any] struct {
+		Key   string `json:"k"`
+		Value T      `json:"v"`
+	}
+
+	// CacheStats holds the statistics of a Cache.
+	CacheStats struct {
+		Hits      uint64
+		Misses    uint64
+		Evictions uint64
+		// Len is the number of entries and Bytes their total size, if WithMaxBytes is used.
+		Len   int
+		Bytes int64
+	}
+
+	// Cache is a thread-safe data store interface for the results of expensive computations.
+	// Once it is full, it evicts its least recently used entries; use WithMaxEntries and WithMaxBytes
+	// to set its capacity.
+	// Like Counters, every method locks the store by itself, so there is no Lock or RLock.
+	Cache[T any] interface {
+		// Get returns the value associated with the given key and marks it as recently used.
+		// The bool result is false on a miss.
+		Get(key string) (T, bool)
+
+		// GetOrLoad is like Get but calls load on a miss and stores its result.
+		// Concurrent misses of the same key share one call of load.
+		// Errors of load are returned and not stored.
+		GetOrLoad(key string, load func(key string) (T, error)) (T, error)
+
+		// Set adds or updates the value associated with the given key.
+		Set(key string, value T)
+
+		// Delete removes the value associated with the given key.
+		Delete(key string)
+
+		// Len returns the number of entries.
+		Len() int
+
+		// Stats returns the hit, miss and eviction counts since the Cache was loaded.
+		Stats() CacheStats
+
+		// Save persists the entries, so a loaded Cache starts warm.
+		// It does nothing for a Cache created with NewCache.
+		Save() error
+	}
+)
+
+// NewCache creates a Cache that is never persisted.
+// The WithMaxEntries and WithMaxBytes options are supported.
+func NewCache[T any](opts ...Option) Cache[T] {
+	o := newOptions(opts)
+	return &memoryCache[T]{
+		entries:    newLRU[T](0),
+		sizes:      make(map[string]int64),
+		maxEntries: o.maxEntries,
+		maxBytes:   o.maxBytes,
+		loading:    make(map[string]*cacheCall[T]),
+	}
+}
+
+func (c *memoryCache[T]) Get(key string) (T, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.lookup(key)
+}
+
+// lookup is Get without locking.
+func (c *memoryCache[T]) lookup(key string) (T, bool) {
+	value, ok := c.entries.get(key)
+	if ok {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	return value, ok
+}
+
+func (c *memoryCache[T]) GetOrLoad(key string, load func(key string) (T, error)) (T, error) {
+	c.mut.Lock()
+	if value, ok := c.lookup(key); ok {
+		c.mut.Unlock()
+		return value, nil
+	}
+	if call, ok := c.loading[key]; ok {
+		c.mut.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call := &cacheCall[T]{done: make(chan struct{})}
+	c.loading[key] = call
+	c.mut.Unlock()
+
+	c.load(call, key, load)
+	if call.err == nil {
+		c.changed()
+	}
+	return call.value, call.err
+}
+
+// load runs load for call and stores the result.
+// The waiting callers are released even if load panics.
+func (c *memoryCache[T]) load(call *cacheCall[T], key string, load func(key string) (T, error)) {
+	defer func() {
+		c.mut.Lock()
+		delete(c.loading, key)
+		if call.err == nil && !call.stale {
+			c.put(key, call.value)
+		}
+		c.mut.Unlock()
+		close(call.done)
+	}()
+	// replaced by the result, unless load panics
+	call.err = fmt.Errorf("failed to load cache entry '%s'", key)
+	call.value, call.err = load(key)
+}
+
+func (c *memoryCache[T]) Set(key string, value T) {
+	c.mut.Lock()
+	c.put(key, value)
+	if call, ok := c.loading[key]; ok {
+		call.stale = true
+	}
+	c.mut.Unlock()
+	c.changed()
+}
+
+// put stores value and evicts the least recently used entries until the Cache fits its capacity.
+func (c *memoryCache[T]) put(key string, value T) {
+	c.entries.put(key, value)
+	if c.maxBytes > 0 {
+		size := int64(len(key))
+		if b, err := json.Marshal(value); err != nil {
+			log(errors.Join(fmt.Errorf("failed to measure size of cache entry '%s'", key), err))
+		} else {
+			size += int64(len(b))
+		}
+		c.bytes += size - c.sizes[key]
+		c.sizes[key] = size
+	}
+	for (c.maxEntries > 0 && c.entries.len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		entry, ok := c.entries.removeOldest()
+		if !ok {
+			break
+		}
+		c.forget(entry.key)
+		c.stats.Evictions++
+	}
+}
+
+// forget drops the size of a removed entry.
+func (c *memoryCache[T]) forget(key string) {
+	c.bytes -= c.sizes[key]
+	delete(c.sizes, key)
+}
+
+func (c *memoryCache[T]) Delete(key string) {
+	c.mut.Lock()
+	c.entries.remove(key)
+	c.forget(key)
+	if call, ok := c.loading[key]; ok {
+		call.stale = true
+	}
+	c.mut.Unlock()
+	c.changed()
+}
+
+func (c *memoryCache[T]) Len() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.entries.len()
+}
+
+func (c *memoryCache[T]) Stats() CacheStats {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	stats := c.stats
+	stats.Len = c.entries.len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// changed schedules a save if the Cache is persisted.
+func (c *memoryCache[T]) changed() {
+	if c.location != "" {
+		notifyChanged(c)
+	}
+}
+
+func (c *memoryCache[T]) Save() error {
+	if c.location == "" {
+		return nil
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	// most recently used first, so loading can restore the order
+	entries := make([]cacheEntry[T], 0, c.entries.len())
+	for key, value := range c.entries.all() {
+		entries = append(entries, cacheEntry[T]{Key: key, Value: value})
+	}
+	return saveFile(c.location, codecOf(c.location), entries)
+}
+
+// LoadCache loads the Cache stored at location.
+// The WithMaxEntries and WithMaxBytes options are supported.
+// If the stored entries exceed the capacity, the least recently used ones are dropped.
+func LoadCache[T any](location string, opts ...Option) (Cache[T], error) {
+	if codec, ok := codecFor(location); ok {
+		if c, err := loadCacheFromFile[T](location, codec, opts); err != nil {
+			return nil, errors.Join(fmt.Errorf("unable to load cache from file '%s'", location), err)
+		} else {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to find loader for '%s'", location)
+}
+
+func loadCacheFromFile[T any](location string, codec Codec, opts []Option) (Cache[T], error) {
+	c := NewCache[T](opts...).(*memoryCache[T])
+	c.location = location
+	var entries []cacheEntry[T]
+	if _, err := loadFile(location, codec, &entries); err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		c.put(entries[i].Key, entries[i].Value)
+	}
+	c.stats.Evictions = 0
+	return c, nil
+}
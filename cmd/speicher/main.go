@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tsukinoko-kun/speicher"
+)
+
+var (
+	asList  = flag.Bool("list", false, "open the file as a List without trying a Map first")
+	replace = flag.Bool("replace", false, "import replaces all values instead of merging them")
+)
+
+const usage = `Usage: speicher [flags] <command> <file> [args]
+
+Commands:
+  get <file> <key>          print the value of a key or index
+  set <file> <key> <json>   set a key or index to a JSON value, an index equal to the length appends
+  del <file> <key>          delete a key or index
+  keys <file>               print all keys or indexes
+  dump <file>               print all values as JSON
+  import <file> <source>    merge the values of another store file into file
+  export <file> <dest>      write all values to another store file, using the codec of its extension
+  stats <file>              print the number of entries, file size and lock status
+  validate <file>           check that the file can be loaded and all values decoded
+
+A file is opened as a Map and, if it does not hold a Map, as a List.
+A missing file opens as an empty Map, so pass -list to create a List.
+".jsonl" files are always Maps.
+
+Commands that change the file take its lock first and fail if a service holds it.
+Registered codecs: %s
+
+Flags:
+`
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), usage, strings.Join(speicher.Codecs(), " "))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmd, location, args := args[0], args[1], args[2:]
+
+	var err error
+	switch cmd {
+	case "get":
+		err = get(location, args)
+	case "set":
+		err = set(location, args)
+	case "del":
+		err = del(location, args)
+	case "keys":
+		err = keys(location)
+	case "dump":
+		err = dump(location)
+	case "import":
+		err = importFile(location, args)
+	case "export":
+		err = exportFile(location, args)
+	case "stats":
+		err = stats(location)
+	case "validate":
+		err = validate(location)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	releaseLocks()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// wantArgs returns an error if args does not have exactly n elements.
+func wantArgs(args []string, n int, names string) error {
+	if len(args) != n {
+		return fmt.Errorf("expected arguments %s", names)
+	}
+	return nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func get(location string, args []string) error {
+	if err := wantArgs(args, 1, "<key>"); err != nil {
+		return err
+	}
+	s, err := openStore(location, *asList, false)
+	if err != nil {
+		return err
+	}
+	value, err := s.get(args[0])
+	if err != nil {
+		return err
+	}
+	return printJSON(value)
+}
+
+func set(location string, args []string) error {
+	if err := wantArgs(args, 2, "<key> <json>"); err != nil {
+		return err
+	}
+	var value any
+	if err := json.Unmarshal([]byte(args[1]), &value); err != nil {
+		return errors.Join(fmt.Errorf("invalid JSON value '%s'", args[1]), err)
+	}
+	s, err := openStore(location, *asList, true)
+	if err != nil {
+		return err
+	}
+	if err := s.set(args[0], value); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func del(location string, args []string) error {
+	if err := wantArgs(args, 1, "<key>"); err != nil {
+		return err
+	}
+	s, err := openStore(location, *asList, true)
+	if err != nil {
+		return err
+	}
+	if err := s.del(args[0]); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func keys(location string) error {
+	s, err := openStore(location, *asList, false)
+	if err != nil {
+		return err
+	}
+	ids := s.ids()
+	if _, ok := s.(*mapStore); ok {
+		slices.Sort(ids)
+	}
+	for _, id := range ids {
+		fmt.Println(id)
+	}
+	return nil
+}
+
+func dump(location string) error {
+	s, err := openStore(location, *asList, false)
+	if err != nil {
+		return err
+	}
+	return printJSON(s.data())
+}
+
+func importFile(location string, args []string) error {
+	if err := wantArgs(args, 1, "<source>"); err != nil {
+		return err
+	}
+	src, err := openStore(args[0], *asList, false)
+	if err != nil {
+		return err
+	}
+	s, err := openStore(location, *asList, true)
+	if err != nil {
+		return err
+	}
+	if *replace {
+		err = s.overwrite(src.data())
+	} else {
+		err = s.merge(src.data())
+	}
+	if err != nil {
+		return errors.Join(fmt.Errorf("unable to import '%s'", args[0]), err)
+	}
+	return s.save()
+}
+
+func exportFile(location string, args []string) error {
+	if err := wantArgs(args, 1, "<dest>"); err != nil {
+		return err
+	}
+	s, err := openStore(location, *asList, false)
+	if err != nil {
+		return err
+	}
+	_, isList := s.(*listStore)
+	dest, err := openStore(args[0], isList, true)
+	if err != nil {
+		return err
+	}
+	if err := dest.overwrite(s.data()); err != nil {
+		return errors.Join(fmt.Errorf("unable to export to '%s'", args[0]), err)
+	}
+	return dest.save()
+}
+
+func stats(location string) error {
+	fi, err := os.Stat(location)
+	if err != nil {
+		return err
+	}
+	s, err := openStore(location, *asList, false)
+	if err != nil {
+		return err
+	}
+
+	kind, expiring := "list", 0
+	if m, ok := s.(*mapStore); ok {
+		kind = "map"
+		expiring = m.expiring()
+	}
+
+	locked, err := speicher.IsLocked(location)
+	if err != nil {
+		return err
+	}
+	lock := "free"
+	if locked {
+		lock = "held by another process"
+	}
+
+	fmt.Printf("type:     %s\n", kind)
+	fmt.Printf("entries:  %d\n", s.len())
+	fmt.Printf("size:     %d bytes\n", fi.Size())
+	fmt.Printf("modified: %s\n", fi.ModTime().Format(time.RFC3339))
+	if kind == "map" {
+		fmt.Printf("expiring: %d\n", expiring)
+	}
+	fmt.Printf("lock:     %s\n", lock)
+	return nil
+}
+
+func validate(location string) error {
+	s, err := openStore(location, *asList, false)
+	if err != nil {
+		return errors.Join(fmt.Errorf("'%s' is invalid", location), err)
+	}
+	// Reading every value decodes the records of a disk-backed Map that are not loaded yet.
+	ids := s.ids()
+	for _, id := range ids {
+		if _, err := s.get(id); err != nil {
+			return errors.Join(fmt.Errorf("'%s' is invalid", location), err)
+		}
+	}
+	fmt.Printf("'%s' is valid, %d entries\n", location, len(ids))
+	return nil
+}
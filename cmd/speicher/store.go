@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tsukinoko-kun/speicher"
+)
+
+type (
+	// store is a Map or a List file, with untyped values.
+	store interface {
+		get(id string) (any, error)
+		set(id string, value any) error
+		del(id string) error
+		// ids returns the keys of a Map or the indexes of a List.
+		ids() []string
+		// data returns all values, as map[string]any for a Map and []any for a List.
+		data() any
+		// overwrite replaces all values with data, which has the type returned by data.
+		overwrite(data any) error
+		// merge adds the values of data, which has the type returned by data.
+		merge(data any) error
+		len() int
+		save() error
+	}
+
+	mapStore struct {
+		m speicher.Map[any]
+	}
+
+	listStore struct {
+		l speicher.List[any]
+	}
+)
+
+// locks holds the locks taken by openStore until releaseLocks is called when the command exits.
+var locks []*speicher.FileLock
+
+// openStore loads the file at location as a Map or, if that fails or list is set, as a List.
+// If write is set, the file is locked first, so a service using it with speicher.WithLock can't
+// change it at the same time. The lock is held until the command exits.
+func openStore(location string, list bool, write bool) (store, error) {
+	if !write {
+		if _, err := os.Stat(location); err != nil {
+			return nil, err
+		}
+	}
+	if write {
+		lock, err := speicher.LockFile(location)
+		if err != nil {
+			if errors.Is(err, speicher.ErrLocked) {
+				return nil, fmt.Errorf("'%s' is in use by another process, stop it before changing the file", location)
+			}
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+	if !list {
+		m, err := speicher.LoadMap[any](location)
+		if err == nil {
+			return &mapStore{m: m}, nil
+		}
+		if strings.HasSuffix(location, ".jsonl") {
+			return nil, err
+		}
+	}
+	l, err := speicher.LoadList[any](location)
+	if err != nil {
+		return nil, err
+	}
+	return &listStore{l: l}, nil
+}
+
+func (s *mapStore) get(key string) (any, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	value, ok := s.m.Get(key)
+	if !ok {
+		return nil, fmt.Errorf("key '%s' not found", key)
+	}
+	return value, nil
+}
+
+func (s *mapStore) set(key string, value any) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.m.Set(key, value)
+}
+
+func (s *mapStore) del(key string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if !s.m.Has(key) {
+		return fmt.Errorf("key '%s' not found", key)
+	}
+	return s.m.Delete(key)
+}
+
+func (s *mapStore) ids() []string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	els := s.m.Query().CollectKV()
+	keys := make([]string, len(els))
+	for i, el := range els {
+		keys[i] = el.Key
+	}
+	return keys
+}
+
+// expiring returns the number of keys with an expiration time.
+func (s *mapStore) expiring() int {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	n := 0
+	for _, el := range s.m.Query().CollectKV() {
+		if _, ok := s.m.ExpiresAt(el.Key); ok {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *mapStore) data() any {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	data := make(map[string]any)
+	for _, el := range s.m.Query().CollectKV() {
+		data[el.Key] = el.Value
+	}
+	return data
+}
+
+func (s *mapStore) overwrite(data any) error {
+	values, ok := data.(map[string]any)
+	if !ok {
+		return errors.New("expected an object of keys and values")
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.m.Overwrite(values)
+}
+
+func (s *mapStore) merge(data any) error {
+	values, ok := data.(map[string]any)
+	if !ok {
+		return errors.New("expected an object of keys and values")
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for key, value := range values {
+		if err := s.m.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *mapStore) len() int {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return len(s.m.Query().CollectKV())
+}
+
+func (s *mapStore) save() error {
+	return s.m.Save()
+}
+
+// index parses the index of a List element.
+func index(id string) (int, error) {
+	i, err := strconv.Atoi(id)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid index '%s'", id)
+	}
+	return i, nil
+}
+
+func (s *listStore) get(id string) (any, error) {
+	i, err := index(id)
+	if err != nil {
+		return nil, err
+	}
+	s.l.RLock()
+	defer s.l.RUnlock()
+	value, ok := s.l.Get(i)
+	if !ok {
+		return nil, fmt.Errorf("index %d out of range", i)
+	}
+	return value, nil
+}
+
+// set replaces the element at id, or appends value if id is the length of the List.
+func (s *listStore) set(id string, value any) error {
+	i, err := index(id)
+	if err != nil {
+		return err
+	}
+	s.l.Lock()
+	defer s.l.Unlock()
+	if i == s.l.Len() {
+		return s.l.Append(value)
+	}
+	if err := s.l.Set(i, value); err != nil {
+		return fmt.Errorf("index %d out of range", i)
+	}
+	return nil
+}
+
+func (s *listStore) del(id string) error {
+	i, err := index(id)
+	if err != nil {
+		return err
+	}
+	s.l.Lock()
+	defer s.l.Unlock()
+	if i >= s.l.Len() {
+		return fmt.Errorf("index %d out of range", i)
+	}
+	return s.l.Overwrite(slices.Delete(s.l.Query().Collect(), i, i+1))
+}
+
+func (s *listStore) ids() []string {
+	n := s.len()
+	ids := make([]string, n)
+	for i := range n {
+		ids[i] = strconv.Itoa(i)
+	}
+	return ids
+}
+
+func (s *listStore) data() any {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	values := s.l.Query().Collect()
+	if values == nil {
+		values = make([]any, 0)
+	}
+	return values
+}
+
+func (s *listStore) overwrite(data any) error {
+	values, ok := data.([]any)
+	if !ok {
+		return errors.New("expected an array of values")
+	}
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.l.Overwrite(values)
+}
+
+func (s *listStore) merge(data any) error {
+	values, ok := data.([]any)
+	if !ok {
+		return errors.New("expected an array of values")
+	}
+	s.l.Lock()
+	defer s.l.Unlock()
+	for _, value := range values {
+		if err := s.l.Append(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *listStore) len() int {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	return s.l.Len()
+}
+
+func (s *listStore) save() error {
+	return s.l.Save()
+}
+
+// releaseLocks releases the locks taken by openStore.
+func releaseLocks() {
+	for _, lock := range locks {
+		_ = lock.Release()
+	}
+	locks = nil
+}
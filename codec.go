@@ -0,0 +1,74 @@
+package speicher
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type (
+	// Codec encodes and decodes the files of the data stores.
+	// Register a Codec with RegisterCodec to store them in a format other than JSON.
+	Codec interface {
+		// Encode writes v to w.
+		Encode(w io.Writer, v any) error
+
+		// Decode reads r into v.
+		Decode(r io.Reader, v any) error
+	}
+
+	// jsonCodec is the Codec for ".json" files.
+	jsonCodec struct{}
+)
+
+var (
+	codecsMut sync.RWMutex
+	codecs    = map[string]Codec{".json": jsonCodec{}}
+)
+
+// RegisterCodec makes the Load functions of the data stores, like LoadMap and LoadQueue, accept files
+// with the given extension, like ".yaml", and read and write them with c. The JSON codec is registered for ".json".
+// The expiration times of a Map are always stored as JSON, and so is a DB, whose buckets are kept as raw JSON
+// until they are opened. TimeSeries segments and disk-backed Maps are JSON Lines files.
+func RegisterCodec(ext string, c Codec) {
+	codecsMut.Lock()
+	defer codecsMut.Unlock()
+	codecs[strings.ToLower(ext)] = c
+}
+
+// Codecs returns the extensions of all registered codecs.
+func Codecs() []string {
+	codecsMut.RLock()
+	defer codecsMut.RUnlock()
+	exts := make([]string, 0, len(codecs))
+	for ext := range codecs {
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+// codecFor returns the Codec registered for the extension of location.
+func codecFor(location string) (Codec, bool) {
+	codecsMut.RLock()
+	defer codecsMut.RUnlock()
+	c, ok := codecs[strings.ToLower(filepath.Ext(location))]
+	return c, ok
+}
+
+// codecOf is like codecFor but falls back to JSON.
+func codecOf(location string) Codec {
+	if c, ok := codecFor(location); ok {
+		return c
+	}
+	return jsonCodec{}
+}
+
+func (jsonCodec) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
@@ -0,0 +1,190 @@
+package speicher
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// counterMinutes is how many minute buckets a counter keeps.
+	counterMinutes = 60
+	// counterHours is how many hour buckets a counter keeps.
+	counterHours = 24
+)
+
+type (
+	// memoryCounters is a Counters implementation that keeps all counters in memory.
+	memoryCounters struct {
+		data     map[string]*counter
+		location string
+		mut      sync.RWMutex
+
+		saveState
+	}
+
+	// counter is the persisted state of a single counter.
+	counter struct {
+		Total int64 `json:"total"`
+		// Minutes and Hours map the start of a bucket in unix minutes or hours to the increments in it.
+		Minutes map[int64]int64 `json:"minutes,omitempty"`
+		Hours   map[int64]int64 `json:"hours,omitempty"`
+	}
+
+	// Counters is a thread-safe data store interface for named int64 counters,
+	// like rate limits or statistics.
+	// Unlike the other data stores, every method locks the store by itself,
+	// so there is no Lock or RLock and every call is atomic.
+	// Besides its total, every counter remembers its increments per minute for the last hour
+	// and per hour for the last day. Older buckets are dropped automatically.
+	Counters interface {
+		// Incr adds delta to the counter with the given key and returns the new total.
+		// A counter that does not exist yet starts at 0.
+		Incr(key string, delta int64) int64
+
+		// Get returns the total of the counter with the given key.
+		// It returns 0 if the counter does not exist.
+		Get(key string) int64
+
+		// Window returns the sum of the increments of the counter with the given key within the last d.
+		// Windows up to an hour are counted per minute, longer windows per hour.
+		// Windows longer than a day are cut to a day.
+		Window(key string, d time.Duration) int64
+
+		// Reset removes the counter with the given key.
+		Reset(key string)
+
+		// Snapshot returns the totals of all counters.
+		Snapshot() map[string]int64
+
+		// Save persists the current state of the Counters to its underlying data store.
+		// It returns an error if the operation fails.
+		Save() error
+	}
+)
+
+// prune drops the buckets that are too old to be part of any window.
+func (c *counter) prune(now time.Time) {
+	minute := now.Unix() / 60
+	for start := range c.Minutes {
+		if start <= minute-counterMinutes {
+			delete(c.Minutes, start)
+		}
+	}
+	hour := now.Unix() / 3600
+	for start := range c.Hours {
+		if start <= hour-counterHours {
+			delete(c.Hours, start)
+		}
+	}
+}
+
+func (c *counter) window(now time.Time, d time.Duration) int64 {
+	buckets, size, limit := c.Minutes, int64(60), int64(counterMinutes)
+	if d > time.Hour {
+		buckets, size, limit = c.Hours, 3600, counterHours
+	}
+	n := min((int64(d.Seconds())+size-1)/size, limit)
+	current := now.Unix() / size
+	var sum int64
+	for start, v := range buckets {
+		if start > current-n && start <= current {
+			sum += v
+		}
+	}
+	return sum
+}
+
+func (c *memoryCounters) Incr(key string, delta int64) int64 {
+	c.mut.Lock()
+	now := time.Now()
+	ctr, ok := c.data[key]
+	if !ok {
+		ctr = &counter{}
+		c.data[key] = ctr
+	}
+	if ctr.Minutes == nil {
+		ctr.Minutes = make(map[int64]int64)
+	}
+	if ctr.Hours == nil {
+		ctr.Hours = make(map[int64]int64)
+	}
+	ctr.prune(now)
+	ctr.Total += delta
+	ctr.Minutes[now.Unix()/60] += delta
+	ctr.Hours[now.Unix()/3600] += delta
+	total := ctr.Total
+	c.mut.Unlock()
+	notifyChanged(c)
+	return total
+}
+
+func (c *memoryCounters) Get(key string) int64 {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	if ctr, ok := c.data[key]; ok {
+		return ctr.Total
+	}
+	return 0
+}
+
+func (c *memoryCounters) Window(key string, d time.Duration) int64 {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	if ctr, ok := c.data[key]; ok {
+		return ctr.window(time.Now(), d)
+	}
+	return 0
+}
+
+func (c *memoryCounters) Reset(key string) {
+	c.mut.Lock()
+	delete(c.data, key)
+	c.mut.Unlock()
+	notifyChanged(c)
+}
+
+func (c *memoryCounters) Snapshot() map[string]int64 {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	snapshot := make(map[string]int64, len(c.data))
+	for key, ctr := range c.data {
+		snapshot[key] = ctr.Total
+	}
+	return snapshot
+}
+
+func (c *memoryCounters) Save() error {
+	// pruning modifies the counters, so this needs the write lock
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	now := time.Now()
+	for _, ctr := range c.data {
+		ctr.prune(now)
+	}
+	return saveFile(c.location, codecOf(c.location), c.data)
+}
+
+func LoadCounters(location string) (Counters, error) {
+	if codec, ok := codecFor(location); ok {
+		if c, err := loadCountersFromFile(location, codec); err != nil {
+			return nil, errors.Join(fmt.Errorf("unable to load counters from file '%s'", location), err)
+		} else {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to find loader for '%s'", location)
+}
+
+func loadCountersFromFile(location string, codec Codec) (Counters, error) {
+	c := &memoryCounters{
+		location: location,
+		data:     make(map[string]*counter),
+	}
+	if _, err := loadFile(location, codec, &c.data); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
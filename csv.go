@@ -0,0 +1,221 @@
+package speicher
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// csvKeyColumn is the header of the column that holds the keys of Map elements.
+const csvKeyColumn = "key"
+
+// csvColumn is a column of a CSV file, which holds a field of the elements or the element itself.
+type csvColumn struct {
+	name string
+	// index is the path of the field in the element, as for reflect.Value.FieldByIndex.
+	// It is empty for the column of an element that is not a struct.
+	index []int
+	// deref is set if the element is a pointer to a struct.
+	deref bool
+}
+
+var textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+
+// csvColumns returns the columns for elements of type t.
+//
+// An element that is a struct, or a pointer to one, is flattened into a column per exported field.
+// Fields of nested structs are named "outer.inner", those of embedded structs are inlined like in JSON.
+// The name of a field is taken from its `csv` tag, then from its `json` tag, then from the field name.
+// Fields tagged with "-" are skipped. Structs that implement encoding.TextMarshaler, like time.Time,
+// are a single column. Any other element is a single column "value".
+//
+// It returns an error if two columns have the same name, or if withKey is set and a column is named "key".
+func csvColumns(t reflect.Type, withKey bool) ([]csvColumn, error) {
+	deref := false
+	if t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct {
+		t, deref = t.Elem(), true
+	}
+	var columns []csvColumn
+	if t.Kind() != reflect.Struct || isTextMarshaler(t) {
+		columns = []csvColumn{{name: "value"}}
+	} else {
+		columns = structColumns(t, nil, "")
+		for i := range columns {
+			columns[i].deref = deref
+		}
+	}
+
+	names := make(map[string]struct{}, len(columns)+1)
+	if withKey {
+		names[csvKeyColumn] = struct{}{}
+	}
+	for _, c := range columns {
+		if _, ok := names[c.name]; ok {
+			return nil, fmt.Errorf("duplicate column '%s' for type '%s'", c.name, t)
+		}
+		names[c.name] = struct{}{}
+	}
+	return columns, nil
+}
+
+// structColumns returns the columns of the fields of the struct type t.
+// index is the path to t and prefix the name prefix of its fields.
+func structColumns(t reflect.Type, index []int, prefix string) []csvColumn {
+	var columns []csvColumn
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		name, ok := fieldName(f)
+		if !ok {
+			continue
+		}
+		path := append(slices.Clone(index), i)
+		if f.Type.Kind() == reflect.Struct && !isTextMarshaler(f.Type) {
+			if f.Anonymous && f.Tag.Get("csv") == "" && f.Tag.Get("json") == "" {
+				columns = append(columns, structColumns(f.Type, path, prefix)...)
+			} else {
+				columns = append(columns, structColumns(f.Type, path, prefix+name+".")...)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		columns = append(columns, csvColumn{name: prefix + name, index: path})
+	}
+	return columns
+}
+
+// fieldName returns the column name of f. The bool result is false if f is skipped.
+func fieldName(f reflect.StructField) (string, bool) {
+	for _, key := range []string{"csv", "json"} {
+		tag, ok := f.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			return "", false
+		}
+		if name != "" {
+			return name, true
+		}
+	}
+	return f.Name, true
+}
+
+func isTextMarshaler(t reflect.Type) bool {
+	return t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
+
+// field returns the value of the column in the element v.
+// If alloc is set, nil struct pointers on the way are allocated, otherwise the bool result is false for them.
+func (c *csvColumn) field(v reflect.Value, alloc bool) (reflect.Value, bool) {
+	if c.deref {
+		if v.IsNil() {
+			if !alloc {
+				return reflect.Value{}, false
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if len(c.index) == 0 {
+		return v, true
+	}
+	return v.FieldByIndex(c.index), true
+}
+
+// encode returns the cell of the column for the element v.
+func (c *csvColumn) encode(v reflect.Value) (string, error) {
+	f, ok := c.field(v, false)
+	if !ok {
+		return "", nil
+	}
+	return encodeCell(f)
+}
+
+// decode sets the field of the column in the element v to the value of cell.
+// An empty cell leaves the field at its zero value.
+func (c *csvColumn) decode(v reflect.Value, cell string) error {
+	if cell == "" {
+		return nil
+	}
+	f, _ := c.field(v, true)
+	return decodeCell(f, cell)
+}
+
+// encodeCell formats v as a cell. Strings, booleans and numbers are written as they are,
+// values implementing encoding.TextMarshaler as their text and all other values as JSON.
+// A nil pointer is an empty cell.
+func encodeCell(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		return string(b), err
+	}
+	if v.CanAddr() {
+		if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			b, err := m.MarshalText()
+			return string(b), err
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+	b, err := json.Marshal(v.Interface())
+	return string(b), err
+}
+
+// decodeCell parses cell into v, the reverse of encodeCell.
+func decodeCell(v reflect.Value, cell string) error {
+	if v.Kind() == reflect.Pointer {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(cell))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(cell)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(cell)
+		v.SetBool(b)
+		return err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(cell, 10, v.Type().Bits())
+		v.SetInt(n)
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(cell, 10, v.Type().Bits())
+		v.SetUint(n)
+		return err
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(cell, v.Type().Bits())
+		v.SetFloat(n)
+		return err
+	}
+	return json.Unmarshal([]byte(cell), v.Addr().Interface())
+}
@@ -0,0 +1,195 @@
+package speicher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// DB is a data store that holds named buckets in one file.
+	// All buckets of a DB share its lock and its save pipeline:
+	// locking one bucket locks the whole DB, and a save writes every bucket in a single atomic write.
+	// Lock the DB itself to update several buckets at once.
+	DB struct {
+		location string
+		mut      sync.RWMutex
+		// records holds the data of the buckets that were not opened yet.
+		records map[string]dbRecord
+		buckets map[string]dbBucket
+
+		saveState
+	}
+
+	// dbRecord is the persisted state of one bucket.
+	dbRecord struct {
+		Data    json.RawMessage      `json:"data"`
+		Expires map[string]time.Time `json:"expires,omitempty"`
+	}
+
+	// dbBucket is a data store that lives in a DB.
+	dbBucket interface {
+		record() (dbRecord, error)
+	}
+)
+
+// OpenDB loads the DB stored at location, which must be a ".json" file.
+// Use MapBucket and ListBucket to access its buckets.
+func OpenDB(location string) (*DB, error) {
+	if strings.HasSuffix(location, ".json") {
+		db := &DB{
+			location: location,
+			records:  make(map[string]dbRecord),
+			buckets:  make(map[string]dbBucket),
+		}
+		if _, err := loadJsonFile(location, &db.records); err != nil {
+			return nil, errors.Join(fmt.Errorf("unable to load db from file '%s'", location), err)
+		}
+		return db, nil
+	}
+	return nil, fmt.Errorf("unable to find loader for '%s'", location)
+}
+
+// MapBucket returns the Map stored in the bucket with the given name.
+// The bucket is created if it does not exist.
+// Opening the same bucket again returns the same Map, as long as T is the same.
+// The Ordered option is supported.
+// MapBucket locks the DB by itself, so don't call it while holding the lock.
+func MapBucket[T any](db *DB, name string, opts ...Option) (Map[T], error) {
+	// not Lock and Unlock, because opening a bucket changes nothing that needs to be saved
+	db.mut.Lock()
+	defer db.mut.Unlock()
+
+	if b, ok := db.buckets[name]; ok {
+		if m, ok := b.(*memoryMap[T]); ok {
+			if m.order != nil {
+				return &orderedMap[T]{m}, nil
+			}
+			return m, nil
+		}
+		return nil, fmt.Errorf("bucket '%s' is already open with a different type", name)
+	}
+	data := make(hashData[T])
+	m := &memoryMap[T]{data: data, db: db}
+	if r, ok := db.records[name]; ok {
+		if err := json.Unmarshal(r.Data, &data); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to decode bucket '%s'", name), err)
+		}
+		if data != nil {
+			m.data = data
+		}
+		if len(r.Expires) > 0 {
+			m.expires = r.Expires
+			m.startJanitor()
+		}
+	}
+	db.buckets[name] = m
+	delete(db.records, name)
+	return newMap(m, newOptions(opts)), nil
+}
+
+// ListBucket returns the List stored in the bucket with the given name.
+// The bucket is created if it does not exist.
+// Opening the same bucket again returns the same List, as long as T is the same.
+// The WithMaxLen option is supported.
+// ListBucket locks the DB by itself, so don't call it while holding the lock.
+func ListBucket[T any](db *DB, name string, opts ...Option) (List[T], error) {
+	db.mut.Lock()
+	defer db.mut.Unlock()
+
+	if b, ok := db.buckets[name]; ok {
+		if l, ok := b.(*memoryList[T]); ok {
+			return l, nil
+		}
+		return nil, fmt.Errorf("bucket '%s' is already open with a different type", name)
+	}
+	l := &memoryList[T]{data: make([]T, 0), db: db, maxLen: newOptions(opts).maxLen}
+	if r, ok := db.records[name]; ok {
+		if err := json.Unmarshal(r.Data, &l.data); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to decode bucket '%s'", name), err)
+		}
+		l.enforceMaxLen()
+	}
+	db.buckets[name] = l
+	delete(db.records, name)
+	return l, nil
+}
+
+// Buckets returns the names of all buckets in the DB, opened or not, in ascending order.
+// Buckets locks the DB by itself, so don't call it while holding the lock of the DB or of one of its buckets.
+func (db *DB) Buckets() []string {
+	db.RLock()
+	defer db.RUnlock()
+	names := make([]string, 0, len(db.records)+len(db.buckets))
+	for name := range db.records {
+		names = append(names, name)
+	}
+	for name := range db.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save persists all buckets of the DB in a single atomic write.
+// It returns an error if the operation fails.
+func (db *DB) Save() error {
+	db.RLock()
+	defer db.RUnlock()
+
+	records := make(map[string]dbRecord, len(db.records)+len(db.buckets))
+	for name, r := range db.records {
+		records[name] = r
+	}
+	for name, b := range db.buckets {
+		r, err := b.record()
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to encode bucket '%s'", name), err)
+		}
+		records[name] = r
+	}
+	return saveJsonFile(db.location, records)
+}
+
+// Lock acquires the write lock for the DB and all of its buckets.
+// Don't forget to use Unlock when you are done.
+func (db *DB) Lock() {
+	db.mut.Lock()
+}
+
+// Unlock releases the write lock for the DB and all of its buckets.
+func (db *DB) Unlock() {
+	db.mut.Unlock()
+	notifyChanged(db)
+}
+
+// RLock acquires the read lock for the DB and all of its buckets.
+// Don't forget to use RUnlock when you are done.
+func (db *DB) RLock() {
+	db.mut.RLock()
+}
+
+// RUnlock releases the read lock for the DB and all of its buckets.
+func (db *DB) RUnlock() {
+	db.mut.RUnlock()
+}
+
+func (m *memoryMap[T]) record() (dbRecord, error) {
+	data, err := json.Marshal(m.data)
+	if err != nil {
+		return dbRecord{}, err
+	}
+	return dbRecord{Data: data, Expires: m.expires}, nil
+}
+
+func (l *memoryList[T]) record() (dbRecord, error) {
+	data, err := json.Marshal(l.data)
+	if err != nil {
+		return dbRecord{}, err
+	}
+	return dbRecord{Data: data}, nil
+}
@@ -0,0 +1,426 @@
+package speicher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+type (
+	// diskData is a mapData that keeps its elements in an append-only JSON Lines file.
+	// Only the keys with the position of their latest record and the recently used values stay in memory.
+	// Changes are kept in memory until the next save, which appends them to the file.
+	// The file is compacted when more than half of it is made of outdated records.
+	diskData[T any] struct {
+		// mut guards everything below, because reading a value updates the cache
+		// and readers of the map only hold its read lock.
+		mut sync.Mutex
+		// file is the data file opened for reading, nil if it does not exist yet.
+		file *os.File
+		// keydir maps every key in the file to its latest record.
+		keydir map[string]diskEntry
+		// dirty holds the changes since the last save.
+		dirty map[string]diskChange[T]
+		cache *lru[T]
+		// size is the length of the file and garbage the number of bytes of outdated records in it.
+		size    int64
+		garbage int64
+		n       int
+	}
+
+	// diskEntry is the position of a record in the data file.
+	diskEntry struct {
+		offset int64
+		length int64
+	}
+
+	diskChange[T any] struct {
+		value   T
+		deleted bool
+	}
+
+	// diskRecord is one line of the data file.
+	// A record with Deleted set is a tombstone that removes the key.
+	diskRecord struct {
+		Key     string          `json:"k"`
+		Value   json.RawMessage `json:"v,omitempty"`
+		Deleted bool            `json:"d,omitempty"`
+	}
+)
+
+func (d *diskData[T]) get(key string) (T, bool) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	if c, ok := d.dirty[key]; ok {
+		return c.value, !c.deleted
+	}
+	value, ok := d.cache.get(key)
+	if !ok {
+		if value, ok = d.read(key); !ok {
+			return value, false
+		}
+		d.cache.put(key, value)
+	}
+	return value, true
+}
+
+// read decodes the value of key from the data file.
+// Errors are logged, because the callers can't handle them, and treated like a missing key.
+func (d *diskData[T]) read(key string) (value T, found bool) {
+	e, ok := d.keydir[key]
+	if !ok {
+		found = false
+		return
+	}
+	buf := make([]byte, e.length)
+	if _, err := d.file.ReadAt(buf, e.offset); err != nil {
+		log(errors.Join(fmt.Errorf("failed to read key '%s' from file '%s'", key, d.file.Name()), err))
+		found = false
+		return
+	}
+	var r struct {
+		Value T `json:"v"`
+	}
+	if err := json.Unmarshal(buf, &r); err != nil {
+		log(errors.Join(fmt.Errorf("failed to decode key '%s' from file '%s'", key, d.file.Name()), err))
+		found = false
+		return
+	}
+	return r.Value, true
+}
+
+func (d *diskData[T]) has(key string) bool {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	return d.exists(key)
+}
+
+func (d *diskData[T]) exists(key string) bool {
+	if c, ok := d.dirty[key]; ok {
+		return !c.deleted
+	}
+	_, ok := d.keydir[key]
+	return ok
+}
+
+func (d *diskData[T]) set(key string, value T) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	if !d.exists(key) {
+		d.n++
+	}
+	d.dirty[key] = diskChange[T]{value: value}
+	d.cache.remove(key)
+}
+
+func (d *diskData[T]) delete(key string) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	if !d.exists(key) {
+		return
+	}
+	d.n--
+	d.dirty[key] = diskChange[T]{deleted: true}
+	d.cache.remove(key)
+}
+
+func (d *diskData[T]) len() int {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	return d.n
+}
+
+// all reads the values from the data file without putting them into the cache,
+// so iterating over all elements does not push out the recently used ones.
+func (d *diskData[T]) all() iter.Seq2[string, T] {
+	return func(yield func(string, T) bool) {
+		for key := range d.keys() {
+			var value T
+			var ok bool
+			d.mut.Lock()
+			if c, isDirty := d.dirty[key]; isDirty {
+				value, ok = c.value, !c.deleted
+			} else if value, ok = d.cache.get(key); !ok {
+				value, ok = d.read(key)
+			}
+			d.mut.Unlock()
+			if ok && !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// keys iterates over a snapshot of the keys, so the map can be changed while iterating.
+func (d *diskData[T]) keys() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		d.mut.Lock()
+		keys := make([]string, 0, d.n)
+		for key := range d.keydir {
+			if c, ok := d.dirty[key]; !ok || !c.deleted {
+				keys = append(keys, key)
+			}
+		}
+		for key, c := range d.dirty {
+			if _, ok := d.keydir[key]; !ok && !c.deleted {
+				keys = append(keys, key)
+			}
+		}
+		d.mut.Unlock()
+		for _, key := range keys {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+func (d *diskData[T]) replace(values map[string]T) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	d.dirty = make(map[string]diskChange[T], len(values))
+	for key := range d.keydir {
+		d.dirty[key] = diskChange[T]{deleted: true}
+	}
+	for key, value := range values {
+		d.dirty[key] = diskChange[T]{value: value}
+	}
+	d.n = len(values)
+	d.cache.clear()
+}
+
+// save appends the changes since the last save to the data file at location.
+func (d *diskData[T]) save(location string) error {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	if len(d.dirty) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(d.dirty))
+	for key := range d.dirty {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	written := make(map[string]diskEntry, len(keys))
+	for _, key := range keys {
+		r := diskRecord{Key: key}
+		if c := d.dirty[key]; c.deleted {
+			if _, ok := d.keydir[key]; !ok {
+				// never written, nothing to remove
+				continue
+			}
+			r.Deleted = true
+		} else {
+			value, err := json.Marshal(c.value)
+			if err != nil {
+				return errors.Join(fmt.Errorf("failed to encode key '%s' for file '%s'", key, location), err)
+			}
+			r.Value = value
+		}
+		line, err := json.Marshal(r)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to encode key '%s' for file '%s'", key, location), err)
+		}
+		written[key] = diskEntry{offset: d.size + int64(buf.Len()), length: int64(len(line))}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	f, err := os.OpenFile(location, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to open file '%s'", location), err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		_ = f.Close()
+		return errors.Join(fmt.Errorf("failed to write file '%s'", location), err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.Join(fmt.Errorf("failed to write file '%s'", location), err)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Join(fmt.Errorf("failed to write file '%s'", location), err)
+	}
+	if d.file == nil {
+		if d.file, err = os.Open(location); err != nil {
+			return errors.Join(fmt.Errorf("failed to open file '%s'", location), err)
+		}
+	}
+
+	d.size += int64(buf.Len())
+	for key, e := range written {
+		if old, ok := d.keydir[key]; ok {
+			d.garbage += old.length + 1
+		}
+		if d.dirty[key].deleted {
+			// the tombstone itself is only needed until the file is compacted
+			d.garbage += e.length + 1
+			delete(d.keydir, key)
+		} else {
+			d.keydir[key] = e
+		}
+	}
+	clear(d.dirty)
+
+	if d.garbage > d.size/2 {
+		return d.compact(location)
+	}
+	return nil
+}
+
+func (d *diskData[T]) close() error {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	if d.file == nil {
+		return nil
+	}
+	if err := d.file.Close(); err != nil {
+		return errors.Join(fmt.Errorf("failed to close file '%s'", d.file.Name()), err)
+	}
+	d.file = nil
+	return nil
+}
+
+// compact rewrites the data file with only the latest record of every key.
+func (d *diskData[T]) compact(location string) error {
+	f, err := os.CreateTemp(filepath.Dir(location), filepath.Base(location)+".*.tmp")
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to compact file '%s'", location), err)
+	}
+	defer os.Remove(f.Name())
+
+	keys := make([]string, 0, len(d.keydir))
+	for key := range d.keydir {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w := bufio.NewWriter(f)
+	keydir := make(map[string]diskEntry, len(d.keydir))
+	var size int64
+	for _, key := range keys {
+		e := d.keydir[key]
+		if _, err := io.Copy(w, io.NewSectionReader(d.file, e.offset, e.length+1)); err != nil {
+			_ = f.Close()
+			return errors.Join(fmt.Errorf("failed to compact file '%s'", location), err)
+		}
+		keydir[key] = diskEntry{offset: size, length: e.length}
+		size += e.length + 1
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return errors.Join(fmt.Errorf("failed to compact file '%s'", location), err)
+	}
+	if err := f.Chmod(0640); err != nil {
+		_ = f.Close()
+		return errors.Join(fmt.Errorf("failed to compact file '%s'", location), err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.Join(fmt.Errorf("failed to compact file '%s'", location), err)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Join(fmt.Errorf("failed to compact file '%s'", location), err)
+	}
+
+	// Windows can't replace a file that is still open, so the data file is closed for the rename
+	// and reopened afterwards, even if renaming failed.
+	_ = d.file.Close()
+	renameErr := os.Rename(f.Name(), location)
+	if d.file, err = os.Open(location); err != nil {
+		return errors.Join(fmt.Errorf("failed to open file '%s'", location), err)
+	}
+	if renameErr != nil {
+		return errors.Join(fmt.Errorf("failed to replace file '%s'", location), renameErr)
+	}
+	d.keydir = keydir
+	d.size = size
+	d.garbage = 0
+	return nil
+}
+
+// loadDiskData scans the data file at location to build the key directory.
+// A partial last line, left behind by a crash while appending, is cut off.
+func loadDiskData[T any](location string, cacheSize int) (*diskData[T], error) {
+	d := &diskData[T]{
+		keydir: make(map[string]diskEntry),
+		dirty:  make(map[string]diskChange[T]),
+		cache:  newLRU[T](cacheSize),
+	}
+	f, err := os.Open(location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return d, os.MkdirAll(filepath.Dir(location), 0740)
+		}
+		return nil, errors.Join(fmt.Errorf("failed to open file '%s'", location), err)
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				if err := os.Truncate(location, d.size); err != nil {
+					_ = f.Close()
+					return nil, errors.Join(fmt.Errorf("failed to repair file '%s'", location), err)
+				}
+			}
+			break
+		}
+		if err != nil {
+			_ = f.Close()
+			return nil, errors.Join(fmt.Errorf("failed to read file '%s'", location), err)
+		}
+		var rec struct {
+			Key     string `json:"k"`
+			Deleted bool   `json:"d"`
+		}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			_ = f.Close()
+			return nil, errors.Join(fmt.Errorf("failed to decode file '%s' at offset %d", location, d.size), err)
+		}
+		length := int64(len(line))
+		if old, ok := d.keydir[rec.Key]; ok {
+			d.garbage += old.length + 1
+		}
+		if rec.Deleted {
+			d.garbage += length
+			delete(d.keydir, rec.Key)
+		} else {
+			d.keydir[rec.Key] = diskEntry{offset: d.size, length: length - 1}
+		}
+		d.size += length
+	}
+	d.file = f
+	d.n = len(d.keydir)
+	return d, nil
+}
+
+func loadMapFromJsonLinesFile[T any](location string, cacheSize int) (*memoryMap[T], error) {
+	data, err := loadDiskData[T](location, cacheSize)
+	if err != nil {
+		return nil, err
+	}
+	m := &memoryMap[T]{data: data, location: location}
+	if err := m.loadExpires(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,327 @@
+package speicher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// minReconnectDelay and maxReconnectDelay bound the delay between two connection attempts of a Follower.
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+type (
+	// Follower mirrors the data stores of a Primary.
+	// Register the data stores with FollowMap and FollowList under the names used at the primary and connect with Run.
+	// The registered data stores reject local writes with ErrFollower until Promote is called.
+	// They are saved as usual, but the position in the change log is not, so a restarted Follower
+	// starts with the full state of the primary.
+	// All methods are safe for concurrent use.
+	Follower struct {
+		mut    sync.Mutex
+		stores map[string]followerStore
+		// epoch and seq are the position in the change log of the primary.
+		epoch string
+		seq   uint64
+	}
+
+	// followerStore is a data store that follows a primary, without its element type.
+	followerStore interface {
+		locker
+		// apply applies a change of the primary.
+		// The caller holds the write lock.
+		apply(c replChange) error
+		// setFollower switches between rejecting and accepting local writes.
+		// The caller holds the write lock.
+		setFollower(follower bool)
+	}
+)
+
+// NewFollower creates a Follower without any data stores.
+func NewFollower() *Follower {
+	return &Follower{stores: make(map[string]followerStore)}
+}
+
+// FollowMap registers m under name, so it mirrors the Map replicated under that name at the primary.
+// FollowMap locks m by itself.
+func FollowMap[T any](f *Follower, name string, m Map[T]) error {
+	mm, ok := asMemoryMap(m)
+	if !ok {
+		return fmt.Errorf("unable to follow map '%s'", name)
+	}
+	return f.register(name, mm)
+}
+
+// FollowList registers l under name, so it mirrors the List replicated under that name at the primary.
+// FollowList locks l by itself.
+func FollowList[T any](f *Follower, name string, l List[T]) error {
+	ml, ok := l.(*memoryList[T])
+	if !ok {
+		return fmt.Errorf("unable to follow list '%s'", name)
+	}
+	return f.register(name, ml)
+}
+
+func (f *Follower) register(name string, s followerStore) error {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if _, ok := f.stores[name]; ok {
+		return fmt.Errorf("data store '%s' is already followed", name)
+	}
+	s.Lock()
+	s.setFollower(true)
+	s.Unlock()
+	f.stores[name] = s
+	return nil
+}
+
+// Seq returns the sequence number of the last change applied.
+func (f *Follower) Seq() uint64 {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return f.seq
+}
+
+// Promote makes the registered data stores accept local writes again, like after a failover.
+// Stop Run before, otherwise changes of the old primary are still applied.
+func (f *Follower) Promote() {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	for _, s := range f.stores {
+		s.Lock()
+		s.setFollower(false)
+		s.Unlock()
+	}
+}
+
+// Run connects to the primary at addr and applies its changes until ctx is done.
+// If the connection breaks, it reconnects and continues after the last applied change.
+// If a change can't be applied, it reconnects and starts over with the full state of the primary.
+// Connection errors are reported through Err. Run returns the error of ctx.
+func (f *Follower) Run(ctx context.Context, addr string) error {
+	delay := minReconnectDelay
+	for {
+		applied, err := f.follow(ctx, addr)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log(errors.Join(fmt.Errorf("replication from '%s' stopped", addr), err))
+		if applied {
+			delay = minReconnectDelay
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// follow runs one connection to the primary.
+// The bool result tells if any change was applied.
+func (f *Follower) follow(ctx context.Context, addr string) (bool, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+
+	f.mut.Lock()
+	hello := replMessage{Type: "hello", Epoch: f.epoch, Seq: f.seq}
+	f.mut.Unlock()
+	if err := encoder.Encode(hello); err != nil {
+		return false, err
+	}
+	var welcome replMessage
+	_ = conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	if err := decoder.Decode(&welcome); err != nil || welcome.Type != "welcome" {
+		return false, errors.Join(errors.New("invalid handshake"), err)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	applied := false
+	if welcome.Snapshots > 0 || welcome.Epoch != hello.Epoch {
+		// A new epoch means a full resync, even without snapshots when the primary has no data stores yet.
+		// The position only moves once all snapshots are applied, so an interrupted transfer starts over.
+		for range welcome.Snapshots {
+			var msg replMessage
+			if err := decoder.Decode(&msg); err != nil {
+				return applied, err
+			}
+			if msg.Change == nil {
+				return applied, errors.New("missing snapshot")
+			}
+			if err := f.apply(*msg.Change); err != nil {
+				return applied, err
+			}
+			applied = true
+		}
+		f.mut.Lock()
+		f.epoch = welcome.Epoch
+		f.seq = welcome.Seq
+		f.mut.Unlock()
+		if err := encoder.Encode(replMessage{Type: "ack", Seq: welcome.Seq}); err != nil {
+			return applied, err
+		}
+	} else if welcome.Seq != hello.Seq {
+		return false, errors.New("primary did not resume at the requested position")
+	}
+
+	for {
+		var msg replMessage
+		if err := decoder.Decode(&msg); err != nil {
+			return applied, err
+		}
+		if msg.Change == nil {
+			continue
+		}
+		f.mut.Lock()
+		seq := f.seq
+		f.mut.Unlock()
+		if msg.Change.Seq <= seq {
+			continue
+		}
+		if msg.Change.Seq != seq+1 {
+			return applied, fmt.Errorf("missing changes between %d and %d", seq, msg.Change.Seq)
+		}
+		if err := f.apply(*msg.Change); err != nil {
+			f.resync()
+			return applied, err
+		}
+		applied = true
+		f.mut.Lock()
+		f.seq = msg.Change.Seq
+		f.mut.Unlock()
+		if err := encoder.Encode(replMessage{Type: "ack", Seq: msg.Change.Seq}); err != nil {
+			return applied, err
+		}
+	}
+}
+
+// apply applies c to its data store.
+// Changes of data stores that are not followed are skipped and reported through Err.
+func (f *Follower) apply(c replChange) error {
+	f.mut.Lock()
+	s, ok := f.stores[c.Store]
+	f.mut.Unlock()
+	if !ok {
+		log(fmt.Errorf("replicated data store '%s' is not followed", c.Store))
+		return nil
+	}
+	s.Lock()
+	err := s.apply(c)
+	s.Unlock()
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to apply change %d to data store '%s'", c.Seq, c.Store), err)
+	}
+	return nil
+}
+
+// resync forgets the position in the change log, so the next connection starts with the full state of the primary.
+func (f *Follower) resync() {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.epoch = ""
+	f.seq = 0
+}
+
+func (m *memoryMap[T]) setFollower(follower bool) {
+	m.follower = follower
+}
+
+func (m *memoryMap[T]) isFollower() bool {
+	return m.follower
+}
+
+func (m *memoryMap[T]) apply(c replChange) error {
+	switch c.Op {
+	case opSet:
+		var value T
+		if err := json.Unmarshal(c.Value, &value); err != nil {
+			return err
+		}
+		m.put(c.Key, value)
+	case opDelete:
+		if m.data.has(c.Key) {
+			m.remove(c.Key)
+		}
+	case opExpire:
+		if !m.data.has(c.Key) {
+			return nil
+		}
+		if c.At == nil {
+			delete(m.expires, c.Key)
+		} else {
+			m.expire(c.Key, *c.At)
+		}
+	case opReset:
+		var s mapSnapshot[T]
+		if err := json.Unmarshal(c.Value, &s); err != nil {
+			return err
+		}
+		if err := m.overwrite(s.Data); err != nil {
+			return err
+		}
+		m.expires = s.Expires
+		if len(m.expires) > 0 {
+			m.startJanitor()
+		}
+	default:
+		return fmt.Errorf("unknown operation '%s'", c.Op)
+	}
+	return nil
+}
+
+func (l *memoryList[T]) setFollower(follower bool) {
+	l.follower = follower
+}
+
+func (l *memoryList[T]) isFollower() bool {
+	return l.follower
+}
+
+func (l *memoryList[T]) apply(c replChange) error {
+	switch c.Op {
+	case opAppend:
+		var value T
+		if err := json.Unmarshal(c.Value, &value); err != nil {
+			return err
+		}
+		l.data = append(l.data, value)
+	case opSet:
+		var value T
+		if err := json.Unmarshal(c.Value, &value); err != nil {
+			return err
+		}
+		if c.Index < 0 || c.Index >= len(l.data) {
+			return fmt.Errorf("index %d out of range", c.Index)
+		}
+		l.data[c.Index] = value
+	case opTrim:
+		l.evict(min(c.Index, len(l.data)))
+	case opReset:
+		var values []T
+		if err := json.Unmarshal(c.Value, &values); err != nil {
+			return err
+		}
+		l.data = values
+	default:
+		return fmt.Errorf("unknown operation '%s'", c.Op)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package speicher
+
+import (
+	"iter"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type (
+	// textIndex is an inverted index over the words in the values of a Map.
+	textIndex[T any] struct {
+		extract func(T) []string
+		// postings maps every term to the keys containing it and the positions of the term in them.
+		postings map[string]map[string][]int
+		// terms keeps all terms sorted for prefix queries.
+		terms *skipList
+		// docTerms remembers the distinct terms of every key for removal.
+		docTerms map[string][]string
+	}
+
+	// SearchHit is an element found by Map.Search.
+	SearchHit[T any] struct {
+		Key   string
+		Value T
+		// Score ranks how well the element matches the query. Higher is better.
+		Score float64
+	}
+
+	// textClause is one part of a search query.
+	textClause struct {
+		terms  []string
+		prefix bool
+	}
+)
+
+// tokenize splits text into lower case words.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// parseTextQuery splits a query into clauses.
+// Quoted text is a phrase, a word ending in * is a prefix and every other word is a term.
+func parseTextQuery(query string) []textClause {
+	var clauses []textClause
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			if terms := tokenize(part); len(terms) > 0 {
+				clauses = append(clauses, textClause{terms: terms})
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			terms := tokenize(word)
+			for j, term := range terms {
+				// only the last term of a word like "foo-ba*" is a prefix
+				prefix := j == len(terms)-1 && strings.HasSuffix(word, "*")
+				clauses = append(clauses, textClause{terms: []string{term}, prefix: prefix})
+			}
+		}
+	}
+	return clauses
+}
+
+func newTextIndex[T any](extract func(T) []string) *textIndex[T] {
+	return &textIndex[T]{
+		extract:  extract,
+		postings: make(map[string]map[string][]int),
+		terms:    newSkipList(),
+		docTerms: make(map[string][]string),
+	}
+}
+
+func buildTextIndex[T any](data iter.Seq2[string, T], extract func(T) []string) *textIndex[T] {
+	idx := newTextIndex(extract)
+	for key, value := range data {
+		idx.add(key, value)
+	}
+	return idx
+}
+
+func (idx *textIndex[T]) add(key string, value T) {
+	pos := 0
+	var terms []string
+	for _, field := range idx.extract(value) {
+		for _, term := range tokenize(field) {
+			docs, ok := idx.postings[term]
+			if !ok {
+				docs = make(map[string][]int)
+				idx.postings[term] = docs
+				idx.terms.insert(term)
+			}
+			if _, ok := docs[key]; !ok {
+				terms = append(terms, term)
+			}
+			docs[key] = append(docs[key], pos)
+			pos++
+		}
+		// leave a gap so that phrases don't match across fields
+		pos++
+	}
+	idx.docTerms[key] = terms
+}
+
+func (idx *textIndex[T]) remove(key string) {
+	for _, term := range idx.docTerms[key] {
+		docs := idx.postings[term]
+		delete(docs, key)
+		if len(docs) == 0 {
+			delete(idx.postings, term)
+			idx.terms.remove(term)
+		}
+	}
+	delete(idx.docTerms, key)
+}
+
+// idf weights a term by how rare it is.
+func (idx *textIndex[T]) idf(term string) float64 {
+	return math.Log(1 + float64(len(idx.docTerms))/float64(len(idx.postings[term])))
+}
+
+// match returns the score of every key matching the clause.
+func (idx *textIndex[T]) match(c textClause) map[string]float64 {
+	scores := make(map[string]float64)
+	switch {
+	case c.prefix:
+		for n := idx.terms.seek(c.terms[0]); n != nil && strings.HasPrefix(n.key, c.terms[0]); n = n.next[0] {
+			idf := idx.idf(n.key)
+			for key, positions := range idx.postings[n.key] {
+				scores[key] += float64(len(positions)) * idf
+			}
+		}
+	case len(c.terms) == 1:
+		idf := idx.idf(c.terms[0])
+		for key, positions := range idx.postings[c.terms[0]] {
+			scores[key] = float64(len(positions)) * idf
+		}
+	default:
+		idf := 0.0
+		for _, term := range c.terms {
+			idf += idx.idf(term)
+		}
+		for key, positions := range idx.postings[c.terms[0]] {
+			if n := idx.phraseCount(key, positions, c.terms[1:]); n > 0 {
+				scores[key] = float64(n) * idf
+			}
+		}
+	}
+	return scores
+}
+
+// phraseCount returns how often rest follows the first phrase term at one of the given positions in key.
+func (idx *textIndex[T]) phraseCount(key string, positions []int, rest []string) int {
+	n := 0
+	for _, start := range positions {
+		found := true
+		for i, term := range rest {
+			if !containsInt(idx.postings[term][key], start+i+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			n++
+		}
+	}
+	return n
+}
+
+func containsInt(sorted []int, x int) bool {
+	i := sort.SearchInts(sorted, x)
+	return i < len(sorted) && sorted[i] == x
+}
+
+// search returns the keys matching all clauses of query with their scores, best match first.
+func (idx *textIndex[T]) search(query string) []SearchHit[T] {
+	clauses := parseTextQuery(query)
+	if len(clauses) == 0 {
+		return nil
+	}
+	var total map[string]float64
+	for _, c := range clauses {
+		scores := idx.match(c)
+		if total == nil {
+			total = scores
+			continue
+		}
+		for key := range total {
+			if s, ok := scores[key]; ok {
+				total[key] += s
+			} else {
+				delete(total, key)
+			}
+		}
+	}
+	hits := make([]SearchHit[T], 0, len(total))
+	for key, score := range total {
+		hits = append(hits, SearchHit[T]{Key: key, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Key < hits[j].Key
+	})
+	return hits
+}
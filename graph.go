@@ -0,0 +1,343 @@
+package speicher
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type (
+	// memoryGraph is a Graph implementation that keeps all nodes and edges in memory.
+	memoryGraph[N, E any] struct {
+		nodes map[string]N
+		// out maps every node to its outgoing edges by target node.
+		out map[string]map[string]E
+		// in maps every node to the sources of its incoming edges.
+		in       map[string]map[string]struct{}
+		location string
+		mut      sync.RWMutex
+
+		saveState
+	}
+
+	// graphData is the persisted state of a Graph.
+	graphData[N, E any] struct {
+		Nodes map[string]N   `json:"nodes"`
+		Edges []GraphEdge[E] `json:"edges"`
+	}
+
+	// GraphEdge is a directed edge of a Graph.
+	GraphEdge[E any] struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Value E      `json:"value"`
+	}
+
+	// Graph is a thread-safe data store interface for nodes of type N connected by directed edges of type E,
+	// like users following users. Nodes are identified by a string ID and there is at most one edge
+	// from one node to another; add edges in both directions for an undirected relationship.
+	// Edges only exist between existing nodes: adding an edge to a missing node fails
+	// and deleting a node deletes all of its edges.
+	Graph[N, E any] interface {
+		// AddNode adds or updates the node with the given ID.
+		AddNode(id string, node N)
+
+		// Node returns the node with the given ID.
+		// The bool result is false if the node does not exist.
+		Node(id string) (N, bool)
+
+		// HasNode checks if a node with the given ID exists.
+		HasNode(id string) bool
+
+		// DeleteNode removes the node with the given ID along with all edges from and to it.
+		// It returns false if the node does not exist.
+		DeleteNode(id string) bool
+
+		// Nodes returns the IDs of all nodes in ascending order.
+		Nodes() []string
+
+		// AddEdge adds or updates the edge from one node to another.
+		// It returns an error if one of the nodes does not exist.
+		AddEdge(from, to string, edge E) error
+
+		// Edge returns the edge from one node to another.
+		// The bool result is false if the edge does not exist.
+		Edge(from, to string) (E, bool)
+
+		// DeleteEdge removes the edge from one node to another.
+		// It returns false if the edge does not exist.
+		DeleteEdge(from, to string) bool
+
+		// Out returns the outgoing edges of the node with the given ID, ordered by target.
+		Out(id string) []GraphEdge[E]
+
+		// In returns the incoming edges of the node with the given ID, ordered by source.
+		In(id string) []GraphEdge[E]
+
+		// Neighbors returns the IDs of the nodes the node with the given ID has an edge to, in ascending order.
+		Neighbors(id string) []string
+
+		// BFS visits the nodes reachable from start along the edges in breadth-first order, start included.
+		// depth is the number of edges between start and the visited node.
+		// Returning false from visit stops the traversal.
+		BFS(start string, visit func(id string, depth int) bool)
+
+		// ShortestPath returns the IDs of the nodes on a path with the fewest edges from one node to another,
+		// both included. It returns nil if there is no such path.
+		ShortestPath(from, to string) []string
+
+		// Len returns the number of nodes.
+		Len() int
+
+		// Save persists the current state of the Graph.
+		// It returns an error if the save operation fails.
+		Save() error
+
+		// Lock acquires the write lock for the data store to allow safe updates.
+		// Don't forget to use Unlock when you are done.
+		Lock()
+
+		// Unlock releases the write lock for the data store.
+		Unlock()
+
+		// RLock acquires the read lock for the data store to allow safe reading.
+		// Don't forget to use RUnlock when you are done.
+		RLock()
+
+		// RUnlock releases the read lock for the data store.
+		RUnlock()
+	}
+)
+
+func (g *memoryGraph[N, E]) AddNode(id string, node N) {
+	g.nodes[id] = node
+}
+
+func (g *memoryGraph[N, E]) Node(id string) (N, bool) {
+	node, ok := g.nodes[id]
+	return node, ok
+}
+
+func (g *memoryGraph[N, E]) HasNode(id string) bool {
+	_, ok := g.nodes[id]
+	return ok
+}
+
+func (g *memoryGraph[N, E]) DeleteNode(id string) bool {
+	if _, ok := g.nodes[id]; !ok {
+		return false
+	}
+	for to := range g.out[id] {
+		g.DeleteEdge(id, to)
+	}
+	for from := range g.in[id] {
+		g.DeleteEdge(from, id)
+	}
+	delete(g.nodes, id)
+	return true
+}
+
+func (g *memoryGraph[N, E]) Nodes() []string {
+	ids := make([]string, 0, len(g.nodes))
+	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (g *memoryGraph[N, E]) AddEdge(from, to string, edge E) error {
+	if _, ok := g.nodes[from]; !ok {
+		return fmt.Errorf("node '%s' does not exist", from)
+	}
+	if _, ok := g.nodes[to]; !ok {
+		return fmt.Errorf("node '%s' does not exist", to)
+	}
+	edges, ok := g.out[from]
+	if !ok {
+		edges = make(map[string]E)
+		g.out[from] = edges
+	}
+	edges[to] = edge
+	sources, ok := g.in[to]
+	if !ok {
+		sources = make(map[string]struct{})
+		g.in[to] = sources
+	}
+	sources[from] = struct{}{}
+	return nil
+}
+
+func (g *memoryGraph[N, E]) Edge(from, to string) (E, bool) {
+	edge, ok := g.out[from][to]
+	return edge, ok
+}
+
+func (g *memoryGraph[N, E]) DeleteEdge(from, to string) bool {
+	if _, ok := g.out[from][to]; !ok {
+		return false
+	}
+	delete(g.out[from], to)
+	if len(g.out[from]) == 0 {
+		delete(g.out, from)
+	}
+	delete(g.in[to], from)
+	if len(g.in[to]) == 0 {
+		delete(g.in, to)
+	}
+	return true
+}
+
+func (g *memoryGraph[N, E]) Out(id string) []GraphEdge[E] {
+	edges := make([]GraphEdge[E], 0, len(g.out[id]))
+	for to, edge := range g.out[id] {
+		edges = append(edges, GraphEdge[E]{From: id, To: to, Value: edge})
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
+
+func (g *memoryGraph[N, E]) In(id string) []GraphEdge[E] {
+	edges := make([]GraphEdge[E], 0, len(g.in[id]))
+	for from := range g.in[id] {
+		edges = append(edges, GraphEdge[E]{From: from, To: id, Value: g.out[from][id]})
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].From < edges[j].From
+	})
+	return edges
+}
+
+func (g *memoryGraph[N, E]) Neighbors(id string) []string {
+	ids := make([]string, 0, len(g.out[id]))
+	for to := range g.out[id] {
+		ids = append(ids, to)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (g *memoryGraph[N, E]) BFS(start string, visit func(id string, depth int) bool) {
+	g.bfs(start, func(id, _ string, depth int) bool {
+		return visit(id, depth)
+	})
+}
+
+// bfs is BFS that also passes the node through which id was reached to visit.
+// Neighbors are visited in ascending order, so the traversal is deterministic.
+func (g *memoryGraph[N, E]) bfs(start string, visit func(id, parent string, depth int) bool) {
+	if _, ok := g.nodes[start]; !ok {
+		return
+	}
+	seen := map[string]struct{}{start: {}}
+	level := []string{start}
+	if !visit(start, "", 0) {
+		return
+	}
+	for depth := 1; len(level) > 0; depth++ {
+		var next []string
+		for _, id := range level {
+			for _, to := range g.Neighbors(id) {
+				if _, ok := seen[to]; ok {
+					continue
+				}
+				seen[to] = struct{}{}
+				if !visit(to, id, depth) {
+					return
+				}
+				next = append(next, to)
+			}
+		}
+		level = next
+	}
+}
+
+func (g *memoryGraph[N, E]) ShortestPath(from, to string) []string {
+	parents := make(map[string]string)
+	found := false
+	g.bfs(from, func(id, parent string, _ int) bool {
+		parents[id] = parent
+		found = id == to
+		return !found
+	})
+	if !found {
+		return nil
+	}
+	var path []string
+	for id := to; id != from; id = parents[id] {
+		path = append(path, id)
+	}
+	path = append(path, from)
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+func (g *memoryGraph[N, E]) Len() int {
+	return len(g.nodes)
+}
+
+func (g *memoryGraph[N, E]) Lock() {
+	g.mut.Lock()
+}
+
+func (g *memoryGraph[N, E]) Unlock() {
+	g.mut.Unlock()
+	notifyChanged(g)
+}
+
+func (g *memoryGraph[N, E]) RLock() {
+	g.mut.RLock()
+}
+
+func (g *memoryGraph[N, E]) RUnlock() {
+	g.mut.RUnlock()
+}
+
+func (g *memoryGraph[N, E]) Save() error {
+	g.RLock()
+	defer g.RUnlock()
+
+	data := graphData[N, E]{Nodes: g.nodes, Edges: make([]GraphEdge[E], 0)}
+	for _, id := range g.Nodes() {
+		data.Edges = append(data.Edges, g.Out(id)...)
+	}
+	return saveFile(g.location, codecOf(g.location), data)
+}
+
+func LoadGraph[N, E any](location string) (Graph[N, E], error) {
+	if c, ok := codecFor(location); ok {
+		if g, err := loadGraphFromFile[N, E](location, c); err != nil {
+			return nil, errors.Join(fmt.Errorf("unable to load graph from file '%s'", location), err)
+		} else {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to find loader for '%s'", location)
+}
+
+func loadGraphFromFile[N, E any](location string, c Codec) (Graph[N, E], error) {
+	g := &memoryGraph[N, E]{
+		location: location,
+		nodes:    make(map[string]N),
+		out:      make(map[string]map[string]E),
+		in:       make(map[string]map[string]struct{}),
+	}
+	var data graphData[N, E]
+	if _, err := loadFile(location, c, &data); err != nil {
+		return nil, err
+	}
+	for id, node := range data.Nodes {
+		g.nodes[id] = node
+	}
+	for _, edge := range data.Edges {
+		if err := g.AddEdge(edge.From, edge.To, edge.Value); err != nil {
+			return nil, errors.Join(fmt.Errorf("invalid edge from '%s' to '%s'", edge.From, edge.To), err)
+		}
+	}
+	return g, nil
+}
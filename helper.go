@@ -1,5 +1,10 @@
 package speicher
 
+import (
+	"iter"
+	"sync"
+)
+
 type Store interface {
 	// Lock acquires the write lock for the data store to allow safe updates.
 	// Don't forget to use Unlock when you are done.
@@ -43,3 +48,29 @@ func Read[S Store, R any](s Store, f func(s Store) R) R {
 	defer s.RUnlock()
 	return f(s)
 }
+
+// emit starts a goroutine that sends the elements of seq to the returned channel.
+// The returned cancel function stops the goroutine early; it is safe to call it more than once.
+func emit[E any](seq iter.Seq[E]) (<-chan E, func()) {
+	ch := make(chan E)
+	done := make(chan struct{})
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+
+	go func() {
+		defer close(ch)
+		for value := range seq {
+			select {
+			case <-done:
+				return
+			case ch <- value:
+			}
+		}
+	}()
+
+	return ch, cancel
+}
@@ -0,0 +1,243 @@
+// Package httpapi serves speicher data stores over HTTP with JSON bodies.
+//
+// Register Maps with HandleMap and Lists with HandleList, then mount the Handler
+// (use http.StripPrefix to serve it below a path):
+//
+//	GET    /maps/{name}?limit=&cursor=   page of elements, ordered by key
+//	POST   /maps/{name}                  store the body under a generated key
+//	GET    /maps/{name}/{key}            get an element
+//	PUT    /maps/{name}/{key}            create or replace an element
+//	DELETE /maps/{name}/{key}            delete an element
+//	GET    /lists/{name}?offset=&limit=  page of elements
+//	POST   /lists/{name}                 append the body
+//	GET    /lists/{name}/{index}         get an element
+//	PUT    /lists/{name}/{index}         replace an element
+//	DELETE /lists/{name}/{index}         remove an element
+//
+// Map elements carry an ETag derived from their version (see speicher.Map.Version).
+// GET honors If-None-Match, PUT and DELETE honor If-Match, and PUT with "If-None-Match: *" only creates.
+// Every request locks the store for its duration, so conditional updates are atomic.
+// Writes to a store that follows a primary (see speicher.Follower) are answered with 421 Misdirected Request.
+package httpapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tsukinoko-kun/speicher"
+)
+
+const (
+	// defaultLimit is the page size if the request does not set one.
+	defaultLimit = 100
+	// maxLimit is the largest page size a request can ask for.
+	maxLimit = 1000
+	// maxBodySize is the largest request body that is accepted.
+	maxBodySize = 10 << 20
+)
+
+type (
+	// Handler is an http.Handler that serves the registered data stores.
+	// It is safe to register stores while serving.
+	Handler struct {
+		mux   *http.ServeMux
+		mut   sync.RWMutex
+		maps  map[string]resource
+		lists map[string]resource
+	}
+
+	// resource handles the requests for one registered data store.
+	resource interface {
+		list(w http.ResponseWriter, r *http.Request)
+		create(w http.ResponseWriter, r *http.Request)
+		get(w http.ResponseWriter, r *http.Request, id string)
+		put(w http.ResponseWriter, r *http.Request, id string)
+		delete(w http.ResponseWriter, r *http.Request, id string)
+	}
+
+	// response is a status code and an encoded body, see newResponse.
+	response struct {
+		status int
+		body   []byte
+	}
+
+	// errorBody is the body of every error response.
+	errorBody struct {
+		Error string `json:"error"`
+	}
+)
+
+// New creates a Handler without any data stores.
+func New() *Handler {
+	h := &Handler{
+		mux:   http.NewServeMux(),
+		maps:  make(map[string]resource),
+		lists: make(map[string]resource),
+	}
+	for _, kind := range []string{"maps", "lists"} {
+		h.mux.HandleFunc("GET /"+kind+"/{name}", h.route(kind, func(res resource, w http.ResponseWriter, r *http.Request) {
+			res.list(w, r)
+		}))
+		h.mux.HandleFunc("POST /"+kind+"/{name}", h.route(kind, func(res resource, w http.ResponseWriter, r *http.Request) {
+			res.create(w, r)
+		}))
+		h.mux.HandleFunc("GET /"+kind+"/{name}/{id}", h.route(kind, func(res resource, w http.ResponseWriter, r *http.Request) {
+			res.get(w, r, r.PathValue("id"))
+		}))
+		h.mux.HandleFunc("PUT /"+kind+"/{name}/{id}", h.route(kind, func(res resource, w http.ResponseWriter, r *http.Request) {
+			res.put(w, r, r.PathValue("id"))
+		}))
+		h.mux.HandleFunc("DELETE /"+kind+"/{name}/{id}", h.route(kind, func(res resource, w http.ResponseWriter, r *http.Request) {
+			res.delete(w, r, r.PathValue("id"))
+		}))
+	}
+	return h
+}
+
+// HandleMap serves m under /maps/{name}.
+// Registering the same name again replaces the Map.
+func HandleMap[T any](h *Handler, name string, m speicher.Map[T]) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.maps[name] = &mapResource[T]{m: m}
+}
+
+// HandleList serves l under /lists/{name}.
+// Registering the same name again replaces the List.
+func HandleList[T any](h *Handler, name string, l speicher.List[T]) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.lists[name] = &listResource[T]{l: l}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// route returns a handler function that looks up the data store of the given kind named in the request.
+func (h *Handler) route(kind string, f func(res resource, w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		h.mut.RLock()
+		res, ok := h.maps[name]
+		if kind == "lists" {
+			res, ok = h.lists[name]
+		}
+		h.mut.RUnlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown %s '%s'", strings.TrimSuffix(kind, "s"), name))
+			return
+		}
+		f(res, w, r)
+	}
+}
+
+// newResponse encodes v as the body of a response with the given status code.
+// Handlers build the response while holding the lock of the data store, so the values can't change
+// while they are encoded, and write it after releasing the lock, so a slow client does not block the store.
+func newResponse(status int, v any) response {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, errors.Join(errors.New("failed to encode response"), err))
+	}
+	return response{status: status, body: append(body, '\n')}
+}
+
+func errorResponse(status int, err error) response {
+	body, _ := json.Marshal(errorBody{Error: err.Error()})
+	return response{status: status, body: append(body, '\n')}
+}
+
+// failedWrite returns the response for a write to a data store that failed with err.
+func failedWrite(err error) response {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, speicher.ErrFollower):
+		status = http.StatusMisdirectedRequest
+	case errors.Is(err, speicher.ErrDuplicate), errors.Is(err, speicher.ErrRestricted):
+		status = http.StatusConflict
+	}
+	return errorResponse(status, err)
+}
+
+// write writes the response. A response without a body only writes the status code.
+func (resp response) write(w http.ResponseWriter) {
+	if resp.body == nil {
+		w.WriteHeader(resp.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.status)
+	_, _ = w.Write(resp.body)
+}
+
+// writeJSON writes v as the body of a response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	newResponse(status, v).write(w)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	errorResponse(status, err).write(w)
+}
+
+// readJSON decodes the body of r into v.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err := decoder.Decode(v); err != nil {
+		return errors.Join(errors.New("invalid request body"), err)
+	}
+	return nil
+}
+
+// limit returns the page size requested by r.
+func limit(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return defaultLimit, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid limit '%s'", s)
+	}
+	return min(n, maxLimit), nil
+}
+
+// etag returns the ETag of an element with the given version.
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// matchETag reports whether an If-Match or If-None-Match header matches the ETag of an element.
+// exists tells if the element exists, which is what "*" matches.
+func matchETag(header string, tag string, exists bool) bool {
+	if !exists {
+		return false
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// newKey returns a random key for an element created with POST.
+func newKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// location returns the Location of an element, relative to the URL of its data store.
+func location(name string, id string) string {
+	return url.PathEscape(name) + "/" + url.PathEscape(id)
+}
@@ -0,0 +1,151 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/tsukinoko-kun/speicher"
+)
+
+type (
+	// listResource serves a List.
+	listResource[T any] struct {
+		l speicher.List[T]
+	}
+
+	// listElement is an element of a List in a response body.
+	listElement[T any] struct {
+		Index int `json:"index"`
+		Value T   `json:"value"`
+	}
+
+	// listPage is the response body of GET /lists/{name}.
+	listPage[T any] struct {
+		Elements []T `json:"elements"`
+		Total    int `json:"total"`
+		// Next is the offset of the following page, omitted on the last page.
+		Next *int `json:"next,omitempty"`
+	}
+)
+
+func (res *listResource[T]) list(w http.ResponseWriter, r *http.Request) {
+	n, err := limit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	offset := 0
+	if s := r.URL.Query().Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid offset '%s'", s))
+			return
+		}
+	}
+
+	resp := func() response {
+		res.l.RLock()
+		defer res.l.RUnlock()
+		body := listPage[T]{Elements: res.l.Query().Offset(offset).Limit(n).Collect(), Total: res.l.Len()}
+		if body.Elements == nil {
+			body.Elements = make([]T, 0)
+		}
+		if next := offset + len(body.Elements); next < body.Total {
+			body.Next = &next
+		}
+		return newResponse(http.StatusOK, body)
+	}()
+	resp.write(w)
+}
+
+func (res *listResource[T]) create(w http.ResponseWriter, r *http.Request) {
+	var value T
+	if err := readJSON(w, r, &value); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp := func() response {
+		res.l.Lock()
+		defer res.l.Unlock()
+		if err := res.l.Append(value); err != nil {
+			return failedWrite(err)
+		}
+		index := res.l.Len() - 1
+		w.Header().Set("Location", location(r.PathValue("name"), strconv.Itoa(index)))
+		return newResponse(http.StatusCreated, listElement[T]{Index: index, Value: value})
+	}()
+	resp.write(w)
+}
+
+// index parses the index of an element from the path.
+// If it is invalid, it writes the error response and returns false.
+func index(w http.ResponseWriter, id string) (int, bool) {
+	i, err := strconv.Atoi(id)
+	if err != nil || i < 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("invalid index '%s'", id))
+		return 0, false
+	}
+	return i, true
+}
+
+func (res *listResource[T]) get(w http.ResponseWriter, r *http.Request, id string) {
+	i, ok := index(w, id)
+	if !ok {
+		return
+	}
+	resp := func() response {
+		res.l.RLock()
+		defer res.l.RUnlock()
+		value, found := res.l.Get(i)
+		if !found {
+			return errorResponse(http.StatusNotFound, fmt.Errorf("index %d out of range", i))
+		}
+		return newResponse(http.StatusOK, value)
+	}()
+	resp.write(w)
+}
+
+func (res *listResource[T]) put(w http.ResponseWriter, r *http.Request, id string) {
+	i, ok := index(w, id)
+	if !ok {
+		return
+	}
+	var value T
+	if err := readJSON(w, r, &value); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	resp := func() response {
+		res.l.Lock()
+		defer res.l.Unlock()
+		if i >= res.l.Len() {
+			return errorResponse(http.StatusNotFound, fmt.Errorf("index %d out of range", i))
+		}
+		if err := res.l.Set(i, value); err != nil {
+			return failedWrite(err)
+		}
+		return newResponse(http.StatusOK, value)
+	}()
+	resp.write(w)
+}
+
+func (res *listResource[T]) delete(w http.ResponseWriter, r *http.Request, id string) {
+	i, ok := index(w, id)
+	if !ok {
+		return
+	}
+	resp := func() response {
+		res.l.Lock()
+		defer res.l.Unlock()
+		if i >= res.l.Len() {
+			return errorResponse(http.StatusNotFound, fmt.Errorf("index %d out of range", i))
+		}
+		if err := res.l.Overwrite(slices.Delete(res.l.Query().Collect(), i, i+1)); err != nil {
+			return failedWrite(err)
+		}
+		return response{status: http.StatusNoContent}
+	}()
+	resp.write(w)
+}
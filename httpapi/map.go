@@ -0,0 +1,166 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/tsukinoko-kun/speicher"
+)
+
+type (
+	// mapResource serves a Map.
+	mapResource[T any] struct {
+		m speicher.Map[T]
+	}
+
+	// mapElement is an element of a Map in a response body.
+	mapElement[T any] struct {
+		Key   string `json:"key"`
+		Value T      `json:"value"`
+	}
+
+	// mapPage is the response body of GET /maps/{name}.
+	mapPage[T any] struct {
+		Elements []mapElement[T] `json:"elements"`
+		// Next is the cursor of the following page, empty on the last page.
+		Next string `json:"next,omitempty"`
+	}
+)
+
+func (res *mapResource[T]) list(w http.ResponseWriter, r *http.Request) {
+	n, err := limit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp := func() response {
+		res.m.RLock()
+		defer res.m.RUnlock()
+		page, err := res.m.Query().Limit(n).Page(r.URL.Query().Get("cursor"))
+		if err != nil {
+			return errorResponse(http.StatusBadRequest, err)
+		}
+		body := mapPage[T]{Elements: make([]mapElement[T], len(page.Elements)), Next: page.Next}
+		for i, el := range page.Elements {
+			body.Elements[i] = mapElement[T]{Key: el.Key, Value: el.Value}
+		}
+		return newResponse(http.StatusOK, body)
+	}()
+	resp.write(w)
+}
+
+func (res *mapResource[T]) create(w http.ResponseWriter, r *http.Request) {
+	var value T
+	if err := readJSON(w, r, &value); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp := func() response {
+		res.m.Lock()
+		defer res.m.Unlock()
+		key := newKey()
+		for res.m.Has(key) {
+			key = newKey()
+		}
+		if resp, ok := res.set(w, key, value); !ok {
+			return resp
+		}
+		w.Header().Set("Location", location(r.PathValue("name"), key))
+		return newResponse(http.StatusCreated, mapElement[T]{Key: key, Value: value})
+	}()
+	resp.write(w)
+}
+
+func (res *mapResource[T]) get(w http.ResponseWriter, r *http.Request, key string) {
+	resp := func() response {
+		res.m.RLock()
+		defer res.m.RUnlock()
+		value, found := res.m.Get(key)
+		if !found {
+			return errorResponse(http.StatusNotFound, fmt.Errorf("key '%s' not found", key))
+		}
+		version, _ := res.m.Version(key)
+		tag := etag(version)
+		w.Header().Set("ETag", tag)
+		if inm := r.Header.Get("If-None-Match"); inm != "" && matchETag(inm, tag, true) {
+			return response{status: http.StatusNotModified}
+		}
+		return newResponse(http.StatusOK, value)
+	}()
+	resp.write(w)
+}
+
+func (res *mapResource[T]) put(w http.ResponseWriter, r *http.Request, key string) {
+	var value T
+	if err := readJSON(w, r, &value); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp := func() response {
+		res.m.Lock()
+		defer res.m.Unlock()
+		version, exists := res.m.Version(key)
+		if resp, ok := precondition(r, etag(version), exists); !ok {
+			return resp
+		}
+		if resp, ok := res.set(w, key, value); !ok {
+			return resp
+		}
+		status := http.StatusOK
+		if !exists {
+			status = http.StatusCreated
+			// relative to the URL of the element itself
+			w.Header().Set("Location", url.PathEscape(key))
+		}
+		return newResponse(status, value)
+	}()
+	resp.write(w)
+}
+
+// set stores value and sets the ETag header.
+// If it fails, it returns the error response and false.
+// The caller holds the write lock.
+func (res *mapResource[T]) set(w http.ResponseWriter, key string, value T) (response, bool) {
+	if err := res.m.Set(key, value); err != nil {
+		return failedWrite(err), false
+	}
+	version, _ := res.m.Version(key)
+	w.Header().Set("ETag", etag(version))
+	return response{}, true
+}
+
+func (res *mapResource[T]) delete(w http.ResponseWriter, r *http.Request, key string) {
+	resp := func() response {
+		res.m.Lock()
+		defer res.m.Unlock()
+		version, exists := res.m.Version(key)
+		if resp, ok := precondition(r, etag(version), exists); !ok {
+			return resp
+		}
+		if !exists {
+			return errorResponse(http.StatusNotFound, fmt.Errorf("key '%s' not found", key))
+		}
+		if err := res.m.Delete(key); err != nil {
+			return failedWrite(err)
+		}
+		return response{status: http.StatusNoContent}
+	}()
+	resp.write(w)
+}
+
+// precondition checks the If-Match and If-None-Match headers of a write.
+// If they don't match, it returns the error response and false.
+func precondition(r *http.Request, tag string, exists bool) (response, bool) {
+	if im := r.Header.Get("If-Match"); im != "" && !matchETag(im, tag, exists) {
+		return errorResponse(http.StatusPreconditionFailed, errors.New("element was changed")), false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" && matchETag(inm, tag, exists) {
+		return errorResponse(http.StatusPreconditionFailed, errors.New("element already exists")), false
+	}
+	return response{}, true
+}
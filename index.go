@@ -0,0 +1,103 @@
+package speicher
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"sort"
+)
+
+// ErrDuplicate is returned when a value would be stored twice in a unique index.
+var ErrDuplicate = errors.New("duplicate value in unique index")
+
+// mapIndex is a secondary index over the values of a Map.
+// It maps every extracted index value to the set of keys whose value produced it.
+type mapIndex[T any] struct {
+	extract func(T) []string
+	unique  bool
+	entries map[string]map[string]struct{}
+	// values remembers the index values of every key, so that removal does not
+	// depend on the element still looking the way it did when it was added.
+	values map[string][]string
+}
+
+func newMapIndex[T any](extract func(T) []string, unique bool) *mapIndex[T] {
+	return &mapIndex[T]{
+		extract: extract,
+		unique:  unique,
+		entries: make(map[string]map[string]struct{}),
+		values:  make(map[string][]string),
+	}
+}
+
+func (idx *mapIndex[T]) add(key string, value T) {
+	values := idx.extract(value)
+	for _, v := range values {
+		keys, ok := idx.entries[v]
+		if !ok {
+			keys = make(map[string]struct{})
+			idx.entries[v] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	idx.values[key] = values
+}
+
+func (idx *mapIndex[T]) remove(key string) {
+	for _, v := range idx.values[key] {
+		keys, ok := idx.entries[v]
+		if !ok {
+			continue
+		}
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(idx.entries, v)
+		}
+	}
+	delete(idx.values, key)
+}
+
+// conflict reports whether storing value under key would violate the uniqueness of the index.
+// It returns the offending index value and the key that already uses it.
+func (idx *mapIndex[T]) conflict(key string, value T) (string, string, bool) {
+	if !idx.unique {
+		return "", "", false
+	}
+	seen := make(map[string]struct{})
+	for _, v := range idx.extract(value) {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		for other := range idx.entries[v] {
+			if other != key {
+				return v, other, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// keys returns the keys indexed under the given value in ascending order.
+func (idx *mapIndex[T]) keys(value string) []string {
+	set := idx.entries[value]
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// buildIndex creates a new index over data.
+// For unique indexes it fails if two keys share an index value.
+func buildIndex[T any](name string, data iter.Seq2[string, T], extract func(T) []string, unique bool) (*mapIndex[T], error) {
+	idx := newMapIndex(extract, unique)
+	for key, value := range data {
+		if v, other, ok := idx.conflict(key, value); ok {
+			return nil, errors.Join(fmt.Errorf("index '%s': value '%s' used by keys '%s' and '%s'", name, v, other, key), ErrDuplicate)
+		}
+		idx.add(key, value)
+	}
+	return idx, nil
+}
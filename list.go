@@ -1,12 +1,8 @@
 package speicher
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 )
@@ -17,11 +13,20 @@ type (
 		data     []T
 		location string
 		mut      sync.RWMutex
-
-		timerMut     sync.Mutex
-		saveTimer    *time.Timer
-		maxSaveTimer *time.Timer
-		saveOnce     *sync.Once
+		// maxLen is the maximum number of elements, 0 means no limit.
+		maxLen  int
+		onEvict func(T)
+		// primary records the changes of the list if it is replicated with ReplicateList.
+		primary *primaryHook
+		// follower is set while the list is a replica of another list, see FollowList.
+		follower bool
+		// lock is the lock on the file, if the list was loaded with WithLock.
+		lock *FileLock
+		// db is the DB the list is a bucket of, if any.
+		// Buckets use the lock and the save pipeline of their DB.
+		db *DB
+
+		saveState
 	}
 
 	// List is a thread-safe list data store interface that provides basic
@@ -39,20 +44,37 @@ type (
 		// If no elements match, it returns an empty slice.
 		FindAll(func(T) bool) (values []T)
 
+		// Query returns a Query to filter, sort and slice the elements of the List.
+		Query() *Query[T]
+
 		// Append adds the provided value to the end of the List.
-		Append(value T)
+		// If the List is capped (see WithMaxLen) and full, the oldest element is evicted.
+		// It returns ErrFollower if the List follows a primary.
+		Append(value T) error
 
 		// AppendUnique adds the provided value to the List only if no existing element is equal to it,
 		// based on the supplied equality function. It returns true if the value was added,
-		// and false otherwise.
-		AppendUnique(value T, equal func(a, b T) bool) bool
+		// and false otherwise. It returns ErrFollower if the List follows a primary.
+		AppendUnique(value T, equal func(a, b T) bool) (bool, error)
 
 		// Set assigns the provided value to the element at the specified index.
 		// If the index is out of bounds, it returns an error.
 		Set(index int, value T) error
 
 		// Overwrite replaces the entire List with the data provided in the slice.
-		Overwrite([]T)
+		// If the List is capped (see WithMaxLen), only the last elements of the slice are kept.
+		// It returns ErrFollower if the List follows a primary.
+		Overwrite([]T) error
+
+		// OnEvict registers a function that is called with every element that is evicted from the List,
+		// either because the List is capped or by TrimOlderThan.
+		OnEvict(f func(T))
+
+		// TrimOlderThan evicts the elements at the start of the List that are older than age.
+		// The time of an element is taken from timeOf. Trimming stops at the first element that is not too old,
+		// so this expects the elements to be appended in chronological order.
+		// It returns the number of evicted elements, or ErrFollower if the List follows a primary.
+		TrimOlderThan(age time.Duration, timeOf func(T) time.Time) (int, error)
 
 		// Len returns the number of elements currently in the List.
 		Len() int
@@ -82,7 +104,7 @@ type (
 )
 
 func (l *memoryList[T]) Get(index int) (value T, found bool) {
-	if index < 0 || index >= len(l.data) {
+	if index >= 0 && index < len(l.data) {
 		value = l.data[index]
 		found = true
 	} else {
@@ -91,18 +113,69 @@ func (l *memoryList[T]) Get(index int) (value T, found bool) {
 	return
 }
 
-func (l *memoryList[T]) Append(value T) {
+func (l *memoryList[T]) Append(value T) error {
+	if l.follower {
+		return ErrFollower
+	}
+	l.append(value)
+	return nil
+}
+
+func (l *memoryList[T]) append(value T) {
 	l.data = append(l.data, value)
+	if l.primary != nil {
+		l.replicateAppend(value)
+	}
+	l.enforceMaxLen()
+}
+
+// evict removes the first n elements and passes them to the eviction callback.
+func (l *memoryList[T]) evict(n int) {
+	if l.onEvict != nil {
+		for _, value := range l.data[:n] {
+			l.onEvict(value)
+		}
+	}
+	l.data = l.data[n:]
+	if l.primary != nil && n > 0 {
+		l.primary.record(replChange{Op: opTrim, Index: n})
+	}
+}
+
+func (l *memoryList[T]) enforceMaxLen() {
+	if l.maxLen > 0 && len(l.data) > l.maxLen {
+		l.evict(len(l.data) - l.maxLen)
+	}
+}
+
+func (l *memoryList[T]) OnEvict(f func(T)) {
+	l.onEvict = f
+}
+
+func (l *memoryList[T]) TrimOlderThan(age time.Duration, timeOf func(T) time.Time) (int, error) {
+	if l.follower {
+		return 0, ErrFollower
+	}
+	cutoff := time.Now().Add(-age)
+	n := 0
+	for n < len(l.data) && timeOf(l.data[n]).Before(cutoff) {
+		n++
+	}
+	l.evict(n)
+	return n, nil
 }
 
-func (l *memoryList[T]) AppendUnique(value T, equal func(a, b T) bool) bool {
+func (l *memoryList[T]) AppendUnique(value T, equal func(a, b T) bool) (bool, error) {
+	if l.follower {
+		return false, ErrFollower
+	}
 	for _, x := range l.data {
 		if equal(x, value) {
-			return false
+			return false, nil
 		}
 	}
-	l.data = append(l.data, value)
-	return true
+	l.append(value)
+	return true, nil
 }
 
 func (l *memoryList[T]) Find(f func(T) bool) (value T, found bool) {
@@ -126,15 +199,29 @@ func (l *memoryList[T]) FindAll(f func(T) bool) (values []T) {
 }
 
 func (l *memoryList[T]) Set(index int, value T) error {
+	if l.follower {
+		return ErrFollower
+	}
 	if index < 0 || index >= len(l.data) {
 		return fmt.Errorf("index out of range")
 	}
 	l.data[index] = value
+	if l.primary != nil {
+		l.replicateSet(index, value)
+	}
 	return nil
 }
 
-func (l *memoryList[T]) Overwrite(values []T) {
+func (l *memoryList[T]) Overwrite(values []T) error {
+	if l.follower {
+		return ErrFollower
+	}
 	l.data = values
+	if l.primary != nil {
+		l.replicateReset(values)
+	}
+	l.enforceMaxLen()
+	return nil
 }
 
 func (l *memoryList[T]) Len() int {
@@ -170,104 +257,83 @@ func (l *memoryList[T]) Range() (<-chan T, func()) {
 }
 
 func (l *memoryList[T]) Lock() {
+	if l.db != nil {
+		l.db.Lock()
+		return
+	}
 	l.mut.Lock()
 }
 
 func (l *memoryList[T]) Unlock() {
+	if l.db != nil {
+		l.db.Unlock()
+		return
+	}
 	l.mut.Unlock()
 	notifyChanged(l)
 }
 
 func (l *memoryList[T]) RLock() {
+	if l.db != nil {
+		l.db.RLock()
+		return
+	}
 	l.mut.RLock()
 }
 
 func (l *memoryList[T]) RUnlock() {
+	if l.db != nil {
+		l.db.RUnlock()
+		return
+	}
 	l.mut.RUnlock()
 }
 
 func (l *memoryList[T]) Save() error {
+	if l.db != nil {
+		return l.db.Save()
+	}
+
 	l.RLock()
 	defer l.RUnlock()
 
-	f, err := os.Create(l.location)
-	if err != nil {
-		return errors.Join(fmt.Errorf("failed to open file '%s'", l.location), err)
-	}
-	encoder := json.NewEncoder(f)
-	if err := encoder.Encode(l.data); err != nil {
-		return errors.Join(fmt.Errorf("failed to encode json file '%s'", l.location), err)
-	}
-	return nil
+	return saveFile(l.location, codecOf(l.location), l.data)
 }
 
-func LoadList[T any](location string) (List[T], error) {
-	if strings.HasSuffix(location, ".json") {
-		if l, err := loadListFromJsonFile[T](location); err != nil {
+// LoadList loads the List stored at location.
+// The file is read and written with the Codec registered for its extension, like ".json".
+// Pass WithMaxLen to get a capped List and WithLock to lock the file.
+func LoadList[T any](location string, opts ...Option) (List[T], error) {
+	o := newOptions(opts)
+	if c, ok := codecFor(location); ok {
+		lock, err := o.lockFile(location)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("unable to load list from file '%s'", location), err)
+		}
+		l, err := loadListFromFile[T](location, c)
+		if err != nil {
+			_ = lock.Release()
 			return nil, errors.Join(fmt.Errorf("unable to load list from file '%s'", location), err)
-		} else {
-			return l, nil
 		}
+		l.lock = lock
+		l.maxLen = o.maxLen
+		l.enforceMaxLen()
+		return l, nil
 	}
 	return nil, fmt.Errorf("unable to find loader for '%s'", location)
 }
 
-func loadListFromJsonFile[T any](location string) (List[T], error) {
+func loadListFromFile[T any](location string, c Codec) (*memoryList[T], error) {
 	l := &memoryList[T]{
 		location: location,
 		data:     make([]T, 0),
 	}
-	f, err := os.Open(location)
-	if err != nil {
-		if os.IsNotExist(err) {
-			err = os.MkdirAll(filepath.Dir(location), 0740)
-			return l, err
-		}
-		return nil, errors.Join(fmt.Errorf("failed to open file '%s'", location), err)
-	}
-	decoder := json.NewDecoder(f)
-	if err := decoder.Decode(&l.data); err != nil {
-		return nil, errors.Join(fmt.Errorf("failed to decode json file '%s'", location), err)
+	if _, err := loadFile(location, c, &l.data); err != nil {
+		return nil, err
 	}
 	return l, nil
 }
 
-func (l *memoryList[T]) getSaveTimer() *time.Timer {
-	l.timerMut.Lock()
-	defer l.timerMut.Unlock()
-	return l.saveTimer
-}
-
-func (l *memoryList[T]) setSaveTimer(t *time.Timer) {
-	l.timerMut.Lock()
-	defer l.timerMut.Unlock()
-	l.saveTimer = t
-}
-
-func (l *memoryList[T]) getMaxSaveTimer() *time.Timer {
-	l.timerMut.Lock()
-	defer l.timerMut.Unlock()
-	return l.maxSaveTimer
-}
-
-func (l *memoryList[T]) setMaxSaveTimer(t *time.Timer) {
-	l.timerMut.Lock()
-	defer l.timerMut.Unlock()
-	l.maxSaveTimer = t
-}
-
-func (l *memoryList[T]) getSaveOnce() *sync.Once {
-	l.timerMut.Lock()
-	defer l.timerMut.Unlock()
-	return l.saveOnce
-}
-
-func (l *memoryList[T]) setSaveOnce(o *sync.Once) {
-	l.timerMut.Lock()
-	defer l.timerMut.Unlock()
-	l.saveOnce = o
-}
-
 func (l *memoryList[T]) WriteE(f func(l *memoryList[T]) (any, error)) (any, error) {
 	l.Lock()
 	defer l.Unlock()
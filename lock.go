@@ -0,0 +1,68 @@
+package speicher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrLocked is returned when a file is locked by another process.
+var ErrLocked = errors.New("file is locked by another process")
+
+// FileLock is an exclusive lock on the file of a data store that is visible to other processes.
+type FileLock struct {
+	f *os.File
+}
+
+// lockLocation returns the location of the lock file of a data store stored at location.
+func lockLocation(location string) string {
+	return location + ".lock"
+}
+
+// LockFile acquires the lock on the file of a data store at location, without waiting.
+// The lock lives in a file next to it with the suffix ".lock" and is released by the operating system
+// when the process exits, even if Release is not called.
+// It returns ErrLocked if another process, or another LockFile of the same process, holds the lock.
+func LockFile(location string) (*FileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(location), 0740); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to lock file '%s'", location), err)
+	}
+	f, err := openLocked(lockLocation(location))
+	if err != nil {
+		if errors.Is(err, ErrLocked) {
+			return nil, errors.Join(fmt.Errorf("unable to lock file '%s'", location), err)
+		}
+		return nil, errors.Join(fmt.Errorf("failed to lock file '%s'", location), err)
+	}
+	return &FileLock{f: f}, nil
+}
+
+// IsLocked reports whether another process holds the lock on the file of a data store at location.
+// Unlike LockFile, it does not create the lock file if there is none.
+func IsLocked(location string) (bool, error) {
+	if _, err := os.Stat(lockLocation(location)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Join(fmt.Errorf("failed to check lock of file '%s'", location), err)
+	}
+	f, err := openLocked(lockLocation(location))
+	if err != nil {
+		if errors.Is(err, ErrLocked) {
+			return true, nil
+		}
+		return false, errors.Join(fmt.Errorf("failed to check lock of file '%s'", location), err)
+	}
+	_ = f.Close()
+	return false, nil
+}
+
+// Release releases the lock.
+// Releasing a nil lock does nothing.
+func (l *FileLock) Release() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
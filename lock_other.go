@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package speicher
+
+import (
+	"os"
+)
+
+// openLocked opens the file at location.
+// There is no file locking on this platform, so the lock is never contended.
+func openLocked(location string) (*os.File, error) {
+	return os.OpenFile(location, os.O_RDWR|os.O_CREATE, 0640)
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package speicher
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// openLocked opens the file at location and locks it with flock.
+func openLocked(location string) (*os.File, error) {
+	f, err := os.OpenFile(location, os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package speicher
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation is the Windows error for opening a file that is open without sharing.
+const errorSharingViolation syscall.Errno = 32
+
+// openLocked opens the file at location without sharing it, which keeps every other open from succeeding.
+func openLocked(location string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(location)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if errors.Is(err, errorSharingViolation) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), location), nil
+}
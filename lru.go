@@ -0,0 +1,100 @@
+package speicher
+
+import (
+	"container/list"
+	"iter"
+)
+
+type (
+	// lru is a least recently used cache of values by key.
+	// It is not safe for concurrent use.
+	lru[T any] struct {
+		capacity int
+		entries  map[string]*list.Element
+		// order holds the entries, most recently used first.
+		order *list.List
+	}
+
+	lruEntry[T any] struct {
+		key   string
+		value T
+	}
+)
+
+func newLRU[T any](capacity int) *lru[T] {
+	return &lru[T]{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *lru[T]) get(key string) (value T, found bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		found = false
+		return
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry[T]).value, true
+}
+
+// put stores value under key and evicts the least recently used entries if the cache is full.
+// It returns the evicted entries.
+func (c *lru[T]) put(key string, value T) []lruEntry[T] {
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*lruEntry[T]).value = value
+		c.order.MoveToFront(e)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[T]{key: key, value: value})
+	var evicted []lruEntry[T]
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		evicted = append(evicted, c.removeElement(c.order.Back()))
+	}
+	return evicted
+}
+
+func (c *lru[T]) remove(key string) {
+	if e, ok := c.entries[key]; ok {
+		c.removeElement(e)
+	}
+}
+
+func (c *lru[T]) removeElement(e *list.Element) lruEntry[T] {
+	entry := e.Value.(*lruEntry[T])
+	c.order.Remove(e)
+	delete(c.entries, entry.key)
+	return *entry
+}
+
+// removeOldest removes the least recently used entry.
+// The bool result is false if the cache is empty.
+func (c *lru[T]) removeOldest() (lruEntry[T], bool) {
+	e := c.order.Back()
+	if e == nil {
+		return lruEntry[T]{}, false
+	}
+	return c.removeElement(e), true
+}
+
+func (c *lru[T]) len() int {
+	return c.order.Len()
+}
+
+// all iterates over the entries, most recently used first, without changing their order.
+func (c *lru[T]) all() iter.Seq2[string, T] {
+	return func(yield func(string, T) bool) {
+		for e := c.order.Front(); e != nil; e = e.Next() {
+			entry := e.Value.(*lruEntry[T])
+			if !yield(entry.key, entry.value) {
+				return
+			}
+		}
+	}
+}
+
+func (c *lru[T]) clear() {
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
@@ -1,27 +1,63 @@
 package speicher
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"iter"
+	"maps"
+	"reflect"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 )
 
 type (
-	// memoryMap is a Map implementation that keeps all elements in memory.
+	// memoryMap is the Map implementation.
+	// Despite its name, the elements are kept wherever its mapData puts them;
+	// everything else, like indexes and expiration times, lives in memory.
 	memoryMap[T any] struct {
-		data     map[string]T
+		data     mapData[T]
 		location string
 		mut      sync.RWMutex
-
-		timerMut     sync.Mutex
-		saveTimer    *time.Timer
-		maxSaveTimer *time.Timer
-		saveOnce     *sync.Once
+		indexes  map[string]*mapIndex[T]
+		// textIndexes holds the full-text indexes created with CreateTextIndex.
+		textIndexes map[string]*textIndex[T]
+		// order keeps the keys sorted if the map was loaded with the Ordered option.
+		order *skipList
+		// sorted caches the keys in ascending order for queries if there is no order, nil if it is outdated.
+		// sortedMut guards it, because queries only hold the read lock.
+		sorted    []string
+		sortedMut sync.Mutex
+		// expires holds the expiration times of the elements set with a TTL.
+		expires map[string]time.Time
+		janitor sync.Once
+		// stopJanitor is closed by Close to stop the janitor, if it was started.
+		stopJanitor chan struct{}
+		closeOnce   sync.Once
+		// versions holds the versions of the elements set since the map was loaded or overwritten.
+		// All other elements have baseVersion. clock is the last version handed out.
+		versions    map[string]uint64
+		baseVersion uint64
+		clock       uint64
+		// primary records the changes of the map if it is replicated with ReplicateMap.
+		primary *primaryHook
+		// follower is set while the map is a replica of another map, see FollowMap.
+		follower bool
+		// lock is the lock on the file, if the map was loaded with WithLock.
+		lock *FileLock
+		// references holds the references to the map registered with AddRef.
+		references []*mapRef
+		// db is the DB the map is a bucket of, if any.
+		// Buckets use the lock and the save pipeline of their DB.
+		db *DB
+		// writing is set while the write lock of the map is held.
+		writing bool
+		// touched holds the values Get returned while writing, if T can be changed in place.
+		// Unlock stores them again, so changes made through them are not lost.
+		touched map[string]T
+
+		saveState
 	}
 
 	// Map is a thread-safe key-value data store interface that provides basic
@@ -29,6 +65,9 @@ type (
 	Map[T any] interface {
 		// Get retrieves an element associated with the given key.
 		// It returns the value and a boolean indicating whether the key exists.
+		// If T is a pointer or holds one, a value returned while the write lock is held can be changed in place
+		// and is stored again on Unlock. Values found any other way, like with Find or RangeKV, must be stored with Set.
+		// Unique indexes can't reject a change in place, so violations are only reported through Err.
 		Get(key string) (T, bool)
 
 		// Find searches for an element that satisfies the given predicate.
@@ -39,16 +78,77 @@ type (
 		// It returns a slice containing all matching elements.
 		FindAll(func(T) bool) (values []T)
 
+		// Query returns a MapQuery to filter, sort and paginate the elements of the data store.
+		Query() *MapQuery[T]
+
 		// Has checks if an element with the given key exists in the data store.
 		// It returns true if the key exists.
 		Has(key string) bool
 
 		// Set adds or updates the element associated with the given key.
-		// If the key already exists, its value is overwritten.
-		Set(key string, value T)
+		// If the key already exists, its value is overwritten and its expiration time is removed.
+		// It returns an error if the value violates a unique index.
+		Set(key string, value T) error
+
+		// SetWithTTL is like Set but the element expires after ttl.
+		// Expired elements are hidden from all methods and deleted by a background janitor.
+		SetWithTTL(key string, value T, ttl time.Duration) error
+
+		// Expire sets the time at which the element associated with the given key expires.
+		// It returns false if the key does not exist, and ErrFollower if the map follows a primary.
+		Expire(key string, at time.Time) (bool, error)
+
+		// Persist removes the expiration time of the element associated with the given key.
+		// It returns false if the key does not exist or has no expiration time,
+		// and ErrFollower if the map follows a primary.
+		Persist(key string) (bool, error)
+
+		// ExpiresAt returns the time at which the element associated with the given key expires.
+		// The bool result is false if the key does not exist or has no expiration time.
+		ExpiresAt(key string) (time.Time, bool)
+
+		// Version returns the version of the element associated with the given key.
+		// The version changes whenever the element is set or changed in place (see Get),
+		// so it can tell if an element was changed in the meantime.
+		// Versions are not persisted but derived from the time the map was loaded, so they keep increasing across restarts.
+		// The bool result is false if the key does not exist.
+		Version(key string) (uint64, bool)
+
+		// Delete removes the element associated with the given key.
+		// Nothing happens if the key does not exist.
+		// The policies of the references registered with AddRef are applied to the elements referring to it.
+		// It returns an error and leaves all data stores unchanged if a Restrict policy is violated,
+		// a Cascade policy reaches a follower or clearing a reference with a Nullify policy fails like Set would.
+		Delete(key string) error
 
 		// Overwrite replaces the entire data store with the provided map.
-		Overwrite(map[string]T)
+		// It returns an error and leaves the data store unchanged if the new data violates a unique index.
+		Overwrite(map[string]T) error
+
+		// CreateIndex adds a secondary index with the given name.
+		// The extract function returns the index values of an element.
+		// The index is maintained on every Set, Delete and Overwrite, and for values changed in place (see Get).
+		CreateIndex(name string, extract func(T) []string) error
+
+		// CreateUniqueIndex is like CreateIndex but no two keys can share an index value.
+		// It returns an error if the existing data already contains duplicates.
+		CreateUniqueIndex(name string, extract func(T) []string) error
+
+		// GetBy returns all elements whose index values contain the given value, ordered by key.
+		// It returns nil if the index does not exist.
+		GetBy(index string, value string) []T
+
+		// CreateTextIndex adds a full-text index with the given name.
+		// The extract function returns the texts of an element that should be searchable.
+		// The index lives in memory only: it is built from the current data when it is created
+		// and maintained on every Set, Delete and Overwrite, and for values changed in place (see Get).
+		CreateTextIndex(name string, extract func(T) []string) error
+
+		// Search returns the elements matching query in the given full-text index, best match first.
+		// A query consists of words that must all match. Quoted words ("foo bar") must appear as a phrase
+		// and a word ending in * (foo*) matches every word that starts with it. Matching ignores case.
+		// It returns nil if the index does not exist.
+		Search(index string, query string) []SearchHit[T]
 
 		// RangeKV returns a read-only channel that emits key-value pair elements
 		// (as MapRangeEl) from the data store, along with a cancellation function
@@ -63,6 +163,12 @@ type (
 		// It returns an error if the save operation fails.
 		Save() error
 
+		// Close stops the background janitor, closes the data file of a ".jsonl" map
+		// and releases the file lock taken with WithLock.
+		// It does not save the data store, so call Save before if there may be unsaved changes.
+		// Don't use the data store after calling Close.
+		Close() error
+
 		// Lock acquires the write lock for the data store to allow safe updates.
 		// Don't forget to use Unlock when you are done.
 		Lock()
@@ -78,6 +184,28 @@ type (
 		RUnlock()
 	}
 
+	// mapData stores the elements of a memoryMap.
+	mapData[T any] interface {
+		get(key string) (T, bool)
+		has(key string) bool
+		set(key string, value T)
+		delete(key string)
+		len() int
+		// all iterates over the elements in no particular order.
+		all() iter.Seq2[string, T]
+		// keys iterates over the keys in no particular order.
+		keys() iter.Seq[string]
+		// replace removes all elements and stores values instead.
+		replace(values map[string]T)
+		// save persists the elements at location.
+		save(location string) error
+		// close releases the files held open.
+		close() error
+	}
+
+	// hashData is a mapData that keeps all elements in memory.
+	hashData[T any] map[string]T
+
 	// MapRangeEl represents a key-value pair element emitted by the Map's RangeKV method.
 	MapRangeEl[T any] struct {
 		Key   string
@@ -85,82 +213,143 @@ type (
 	}
 )
 
-// Update RangeKV method
-func (m *memoryMap[T]) RangeKV() (<-chan MapRangeEl[T], func()) {
-	ch := make(chan MapRangeEl[T])
-	done := make(chan struct{})
-	cancel := func() {
-		select {
-		case <-done:
-			// channel already closed, no-op
-			return
-		default:
-			if done != nil {
-				close(done)
-				done = nil
+// all iterates over the elements of the map.
+// Ordered maps yield the elements in ascending key order.
+func (m *memoryMap[T]) all() iter.Seq2[string, T] {
+	return func(yield func(string, T) bool) {
+		now := time.Now()
+		if m.order != nil {
+			for n := m.order.first(); n != nil; n = n.next[0] {
+				if m.expired(n.key, now) {
+					continue
+				}
+				value, _ := m.data.get(n.key)
+				if !yield(n.key, value) {
+					return
+				}
 			}
+			return
 		}
-	}
-
-	go func() {
-		defer func() {
-			if done != nil {
-				close(done)
-				done = nil
+		for key, value := range m.data.all() {
+			if m.expired(key, now) {
+				continue
 			}
-			if ch != nil {
-				close(ch)
-				ch = nil
-			}
-		}()
-		for key, value := range m.data {
-			select {
-			case <-done:
+			if !yield(key, value) {
 				return
-			case ch <- MapRangeEl[T]{Key: key, Value: value}:
 			}
 		}
-	}()
-
-	return ch, cancel
+	}
 }
 
-// Update RangeV method
-func (m *memoryMap[T]) RangeV() (<-chan T, func()) {
-	ch := make(chan T)
-	done := make(chan struct{})
-	cancel := func() {
-		select {
-		case <-done:
-			// channel already closed, no-op
+// keysFrom iterates over the keys in ascending order, starting at the first one that is not less than from.
+func (m *memoryMap[T]) keysFrom(from string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		if m.order != nil {
+			for n := m.order.seek(from); n != nil; n = n.next[0] {
+				if !yield(n.key) {
+					return
+				}
+			}
 			return
-		default:
-			close(done)
+		}
+		m.sortedMut.Lock()
+		if m.sorted == nil {
+			m.sorted = slices.Sorted(m.data.keys())
+		}
+		keys := m.sorted
+		m.sortedMut.Unlock()
+		i, _ := slices.BinarySearch(keys, from)
+		for _, key := range keys[i:] {
+			if !yield(key) {
+				return
+			}
 		}
 	}
+}
 
-	go func() {
-		defer close(ch)
-		defer close(done)
-		for _, value := range m.data {
-			select {
-			case <-done:
+func (m *memoryMap[T]) RangeKV() (<-chan MapRangeEl[T], func()) {
+	return emit(func(yield func(MapRangeEl[T]) bool) {
+		for key, value := range m.all() {
+			if !yield(MapRangeEl[T]{Key: key, Value: value}) {
 				return
-			case ch <- value:
 			}
 		}
-	}()
+	})
+}
 
-	return ch, cancel
+func (m *memoryMap[T]) RangeV() (<-chan T, func()) {
+	return emit(func(yield func(T) bool) {
+		for _, value := range m.all() {
+			if !yield(value) {
+				return
+			}
+		}
+	})
 }
 
 func (m *memoryMap[T]) Get(key string) (value T, found bool) {
-	value, found = m.data[key]
+	if !m.live(key) {
+		found = false
+		return
+	}
+	if value, found = m.touched[key]; found {
+		return
+	}
+	value, found = m.data.get(key)
+	if found && m.writing && changeable(reflect.TypeFor[T]()) {
+		if m.touched == nil {
+			m.touched = make(map[string]T)
+		}
+		m.touched[key] = value
+	}
 	return
 }
 
+// changeable reports whether values of type t can be changed in place, because they are or hold a reference.
+func changeable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return true
+	case reflect.Array:
+		return changeable(t.Elem())
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if changeable(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// storeTouched stores the values returned by Get while writing again.
+// It returns the violations of unique indexes, which can't be rejected anymore.
+func (m *memoryMap[T]) storeTouched() []error {
+	var errs []error
+	for key, value := range m.touched {
+		for name, idx := range m.indexes {
+			if v, other, ok := idx.conflict(key, value); ok {
+				errs = append(errs, errors.Join(fmt.Errorf("index '%s': value '%s' of key '%s' already used by key '%s'", name, v, key, other), ErrDuplicate))
+			}
+		}
+		m.unindex(key)
+		m.data.set(key, value)
+		m.index(key, value)
+		m.newVersion(key)
+		if m.primary != nil {
+			m.replicateSet(key, value)
+			// a set removes the expiration time at the followers
+			if at, ok := m.expires[key]; ok {
+				m.primary.record(replChange{Op: opExpire, Key: key, At: &at})
+			}
+		}
+	}
+	clear(m.touched)
+	return errs
+}
+
 func (m *memoryMap[T]) Find(f func(T) bool) (value T, found bool) {
-	for _, value = range m.data {
+	for _, value = range m.all() {
 		if f(value) {
 			found = true
 			return
@@ -171,7 +360,7 @@ func (m *memoryMap[T]) Find(f func(T) bool) (value T, found bool) {
 }
 
 func (m *memoryMap[T]) FindAll(f func(T) bool) (values []T) {
-	for _, value := range m.data {
+	for _, value := range m.all() {
 		if f(value) {
 			values = append(values, value)
 		}
@@ -180,110 +369,347 @@ func (m *memoryMap[T]) FindAll(f func(T) bool) (values []T) {
 }
 
 func (m *memoryMap[T]) Has(key string) bool {
-	_, ok := m.data[key]
-	return ok
+	return m.live(key)
 }
 
-func (m *memoryMap[T]) Set(key string, value T) {
-	m.data[key] = value
+func (m *memoryMap[T]) Set(key string, value T) error {
+	if err := m.checkSet(key, value); err != nil {
+		return err
+	}
+	m.put(key, value)
+	return nil
 }
 
-func (m *memoryMap[T]) Overwrite(values map[string]T) {
-	m.data = values
+// checkSet returns an error if Set must not store value under key.
+// Expired elements that still hold a value of a unique index are deleted to make room.
+func (m *memoryMap[T]) checkSet(key string, value T) error {
+	if m.follower {
+		return ErrFollower
+	}
+	now := time.Now()
+	for name, idx := range m.indexes {
+		for {
+			v, other, ok := idx.conflict(key, value)
+			if !ok {
+				break
+			}
+			if !m.expired(other, now) {
+				return errors.Join(fmt.Errorf("index '%s': value '%s' already used by key '%s'", name, v, other), ErrDuplicate)
+			}
+			// the element holding the value expired, so it can make room right away
+			m.remove(other)
+		}
+	}
+	return nil
 }
 
-func (m *memoryMap[T]) Lock() {
-	m.mut.Lock()
+func (m *memoryMap[T]) Version(key string) (uint64, bool) {
+	if !m.live(key) {
+		return 0, false
+	}
+	if v, ok := m.versions[key]; ok {
+		return v, true
+	}
+	return m.baseVersion, true
 }
-func (m *memoryMap[T]) Unlock() {
-	m.mut.Unlock()
-	notifyChanged(m)
+
+func (m *memoryMap[T]) Delete(key string) error {
+	if m.follower {
+		return ErrFollower
+	}
+	if !m.data.has(key) {
+		return nil
+	}
+	if len(m.references) > 0 {
+		return m.deleteReferenced(key)
+	}
+	m.remove(key)
+	return nil
 }
 
-func (m *memoryMap[T]) RLock() {
-	m.mut.RLock()
+// put stores value under key and updates the indexes.
+// The caller must make sure that no unique index is violated.
+func (m *memoryMap[T]) put(key string, value T) {
+	if m.data.has(key) {
+		m.unindex(key)
+	} else {
+		m.sorted = nil
+	}
+	delete(m.touched, key)
+	delete(m.expires, key)
+	m.data.set(key, value)
+	m.newVersion(key)
+	if m.primary != nil {
+		m.replicateSet(key, value)
+	}
+	m.index(key, value)
+	if m.order != nil {
+		m.order.insert(key)
+	}
 }
-func (m *memoryMap[T]) RUnlock() {
-	m.mut.RUnlock()
+
+// index adds value to the indexes.
+func (m *memoryMap[T]) index(key string, value T) {
+	for _, idx := range m.indexes {
+		idx.add(key, value)
+	}
+	for _, idx := range m.textIndexes {
+		idx.add(key, value)
+	}
 }
 
-func (m *memoryMap[T]) Save() error {
-	m.RLock()
-	defer m.RUnlock()
+// newVersion gives the element with the given key the next version.
+func (m *memoryMap[T]) newVersion(key string) {
+	m.clock++
+	if m.versions == nil {
+		m.versions = make(map[string]uint64)
+	}
+	m.versions[key] = m.clock
+}
 
-	f, err := os.Create(m.location)
-	if err != nil {
-		return errors.Join(fmt.Errorf("failed to open file '%s'", m.location), err)
+// remove deletes key and updates the indexes.
+func (m *memoryMap[T]) remove(key string) {
+	m.unindex(key)
+	m.data.delete(key)
+	delete(m.touched, key)
+	m.sorted = nil
+	delete(m.expires, key)
+	delete(m.versions, key)
+	if m.primary != nil {
+		m.primary.record(replChange{Op: opDelete, Key: key})
 	}
-	encoder := json.NewEncoder(f)
-	if err := encoder.Encode(m.data); err != nil {
-		return errors.Join(fmt.Errorf("failed to encode json file '%s'", m.location), err)
+	if m.order != nil {
+		m.order.remove(key)
+	}
+}
+
+func (m *memoryMap[T]) unindex(key string) {
+	for _, idx := range m.indexes {
+		idx.remove(key)
+	}
+	for _, idx := range m.textIndexes {
+		idx.remove(key)
 	}
-	return nil
 }
 
-func LoadMap[T any](location string) (Map[T], error) {
-	if strings.HasSuffix(location, ".json") {
-		if m, err := loadMapFromJsonFile[T](location); err != nil {
-			return nil, errors.Join(fmt.Errorf("unable to load map from file '%s'", location), err)
-		} else {
-			return m, nil
+func (m *memoryMap[T]) Overwrite(values map[string]T) error {
+	if m.follower {
+		return ErrFollower
+	}
+	return m.overwrite(values)
+}
+
+func (m *memoryMap[T]) overwrite(values map[string]T) error {
+	if values == nil {
+		values = make(map[string]T)
+	}
+	indexes := make(map[string]*mapIndex[T], len(m.indexes))
+	for name, idx := range m.indexes {
+		newIdx, err := buildIndex(name, maps.All(values), idx.extract, idx.unique)
+		if err != nil {
+			return err
 		}
+		indexes[name] = newIdx
+	}
+	m.data.replace(values)
+	clear(m.touched)
+	m.sorted = nil
+	m.clock++
+	m.baseVersion = m.clock
+	m.versions = nil
+	m.indexes = indexes
+	m.expires = nil
+	for name, idx := range m.textIndexes {
+		m.textIndexes[name] = buildTextIndex(maps.All(values), idx.extract)
 	}
-	return nil, fmt.Errorf("unable to find loader for '%s'", location)
+	if m.order != nil {
+		m.order = orderKeys(maps.Keys(values))
+	}
+	if m.primary != nil {
+		m.replicateReset(values)
+	}
+	return nil
 }
 
-func loadMapFromJsonFile[T any](location string) (Map[T], error) {
-	m := &memoryMap[T]{data: make(map[string]T), location: location}
-	f, err := os.Open(location)
+func (m *memoryMap[T]) CreateIndex(name string, extract func(T) []string) error {
+	return m.createIndex(name, extract, false)
+}
+
+func (m *memoryMap[T]) CreateUniqueIndex(name string, extract func(T) []string) error {
+	return m.createIndex(name, extract, true)
+}
+
+func (m *memoryMap[T]) createIndex(name string, extract func(T) []string, unique bool) error {
+	if _, ok := m.indexes[name]; ok {
+		return fmt.Errorf("index '%s' already exists", name)
+	}
+	idx, err := buildIndex(name, m.data.all(), extract, unique)
 	if err != nil {
-		if os.IsNotExist(err) {
-			err = os.MkdirAll(filepath.Dir(location), 0740)
-			return m, err
+		return err
+	}
+	if m.indexes == nil {
+		m.indexes = make(map[string]*mapIndex[T])
+	}
+	m.indexes[name] = idx
+	return nil
+}
+
+func (m *memoryMap[T]) GetBy(index string, value string) []T {
+	idx, ok := m.indexes[index]
+	if !ok {
+		return nil
+	}
+	keys := idx.keys(value)
+	values := make([]T, 0, len(keys))
+	now := time.Now()
+	for _, key := range keys {
+		if !m.expired(key, now) {
+			value, _ := m.data.get(key)
+			values = append(values, value)
 		}
-		return nil, errors.Join(fmt.Errorf("failed to open file '%s'", location), err)
 	}
-	decoder := json.NewDecoder(f)
-	if err := decoder.Decode(&m.data); err != nil {
-		return nil, errors.Join(fmt.Errorf("failed to decode json file '%s'", location), err)
+	return values
+}
+
+func (m *memoryMap[T]) CreateTextIndex(name string, extract func(T) []string) error {
+	if _, ok := m.textIndexes[name]; ok {
+		return fmt.Errorf("text index '%s' already exists", name)
 	}
-	return m, nil
+	if m.textIndexes == nil {
+		m.textIndexes = make(map[string]*textIndex[T])
+	}
+	m.textIndexes[name] = buildTextIndex(m.data.all(), extract)
+	return nil
 }
 
-func (m *memoryMap[T]) getSaveTimer() *time.Timer {
-	m.timerMut.Lock()
-	defer m.timerMut.Unlock()
-	return m.saveTimer
+func (m *memoryMap[T]) Search(index string, query string) []SearchHit[T] {
+	idx, ok := m.textIndexes[index]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	hits := idx.search(query)
+	live := hits[:0]
+	for _, hit := range hits {
+		if !m.expired(hit.Key, now) {
+			hit.Value, _ = m.data.get(hit.Key)
+			live = append(live, hit)
+		}
+	}
+	return live
 }
 
-func (m *memoryMap[T]) setSaveTimer(t *time.Timer) {
-	m.timerMut.Lock()
-	defer m.timerMut.Unlock()
-	m.saveTimer = t
+func (m *memoryMap[T]) Lock() {
+	if m.db != nil {
+		m.db.Lock()
+	} else {
+		m.mut.Lock()
+	}
+	m.writing = true
+}
+func (m *memoryMap[T]) Unlock() {
+	errs := m.storeTouched()
+	m.writing = false
+	if m.db != nil {
+		m.db.Unlock()
+	} else {
+		m.mut.Unlock()
+		notifyChanged(m)
+	}
+	// reported after unlocking, because nobody may be reading Err
+	for _, err := range errs {
+		log(err)
+	}
 }
 
-func (m *memoryMap[T]) getMaxSaveTimer() *time.Timer {
-	m.timerMut.Lock()
-	defer m.timerMut.Unlock()
-	return m.maxSaveTimer
+func (m *memoryMap[T]) RLock() {
+	if m.db != nil {
+		m.db.RLock()
+		return
+	}
+	m.mut.RLock()
+}
+func (m *memoryMap[T]) RUnlock() {
+	if m.db != nil {
+		m.db.RUnlock()
+		return
+	}
+	m.mut.RUnlock()
 }
 
-func (m *memoryMap[T]) setMaxSaveTimer(t *time.Timer) {
-	m.timerMut.Lock()
-	defer m.timerMut.Unlock()
-	m.maxSaveTimer = t
+func (m *memoryMap[T]) Save() error {
+	if m.db != nil {
+		return m.db.Save()
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+
+	// The expiration times are written first: if saving the data fails,
+	// an element may keep its old value without an expiration time, but no new element stays forever.
+	if err := m.saveExpires(); err != nil {
+		return err
+	}
+	return m.data.save(m.location)
 }
 
-func (m *memoryMap[T]) getSaveOnce() *sync.Once {
-	m.timerMut.Lock()
-	defer m.timerMut.Unlock()
-	return m.saveOnce
+// LoadMap loads the Map stored at location.
+// A file with the extension of a registered Codec, like ".json", is loaded into memory as a whole.
+// A ".jsonl" file is an append-only log of which only the keys and the recently used values
+// are kept in memory, for data sets that don't fit into memory; see WithCacheSize.
+// Pass Ordered to get an OrderedMap and WithLock to lock the file.
+func LoadMap[T any](location string, opts ...Option) (Map[T], error) {
+	o := newOptions(opts)
+	var load func() (*memoryMap[T], error)
+	if strings.HasSuffix(location, ".jsonl") {
+		load = func() (*memoryMap[T], error) {
+			return loadMapFromJsonLinesFile[T](location, o.cacheSize)
+		}
+	} else if c, ok := codecFor(location); ok {
+		load = func() (*memoryMap[T], error) {
+			return loadMapFromFile[T](location, c)
+		}
+	} else {
+		return nil, fmt.Errorf("unable to find loader for '%s'", location)
+	}
+
+	lock, err := o.lockFile(location)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("unable to load map from file '%s'", location), err)
+	}
+	m, err := load()
+	if err != nil {
+		_ = lock.Release()
+		return nil, errors.Join(fmt.Errorf("unable to load map from file '%s'", location), err)
+	}
+	m.lock = lock
+	return newMap(m, o), nil
 }
 
-func (m *memoryMap[T]) setSaveOnce(o *sync.Once) {
-	m.timerMut.Lock()
-	defer m.timerMut.Unlock()
-	m.saveOnce = o
+// newMap applies the options to a loaded map.
+func newMap[T any](m *memoryMap[T], o *options) Map[T] {
+	m.baseVersion = uint64(time.Now().UnixNano())
+	m.clock = m.baseVersion
+	if o.ordered {
+		m.order = orderKeys(m.data.keys())
+		return &orderedMap[T]{m}
+	}
+	return m
+}
+
+func loadMapFromFile[T any](location string, c Codec) (*memoryMap[T], error) {
+	data := make(hashData[T])
+	if _, err := loadFile(location, c, &data); err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = make(hashData[T])
+	}
+	m := &memoryMap[T]{data: data, location: location}
+	if err := m.loadExpires(); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
 func (m *memoryMap[T]) WriteE(f func(m *memoryMap[T]) (any, error)) (any, error) {
@@ -309,3 +735,46 @@ func (m *memoryMap[T]) Read(f func(m *memoryMap[T]) any) any {
 	defer m.RUnlock()
 	return f(m)
 }
+
+func (d hashData[T]) get(key string) (T, bool) {
+	value, ok := d[key]
+	return value, ok
+}
+
+func (d hashData[T]) has(key string) bool {
+	_, ok := d[key]
+	return ok
+}
+
+func (d hashData[T]) set(key string, value T) {
+	d[key] = value
+}
+
+func (d hashData[T]) delete(key string) {
+	delete(d, key)
+}
+
+func (d hashData[T]) len() int {
+	return len(d)
+}
+
+func (d hashData[T]) all() iter.Seq2[string, T] {
+	return maps.All(d)
+}
+
+func (d hashData[T]) keys() iter.Seq[string] {
+	return maps.Keys(d)
+}
+
+func (d hashData[T]) replace(values map[string]T) {
+	clear(d)
+	maps.Copy(d, values)
+}
+
+func (d hashData[T]) save(location string) error {
+	return saveFile(location, codecOf(location), d)
+}
+
+func (d hashData[T]) close() error {
+	return nil
+}
@@ -0,0 +1,218 @@
+package speicher
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+type (
+	// memoryMultiMap is a MultiMap implementation that keeps all elements in memory.
+	memoryMultiMap[T comparable] struct {
+		data map[string][]T
+		// reverse maps every value to the keys it is stored under.
+		reverse  map[T]map[string]struct{}
+		location string
+		mut      sync.RWMutex
+
+		saveState
+	}
+
+	// MultiMap is a thread-safe data store interface that associates every key with a set of values,
+	// like tags with items. Values can be looked up by key and keys by value.
+	MultiMap[T comparable] interface {
+		// Add associates value with key.
+		// It returns true if the value was added, and false if the key already had it.
+		Add(key string, value T) bool
+
+		// RemoveValue removes value from key.
+		// It returns true if the value was removed, and false if the key did not have it.
+		RemoveValue(key string, value T) bool
+
+		// Delete removes key with all of its values.
+		Delete(key string)
+
+		// GetAll returns the values of key in the order they were added.
+		// It returns nil if the key does not exist.
+		GetAll(key string) []T
+
+		// Contains checks if key has value.
+		Contains(key string, value T) bool
+
+		// Keys returns all keys that have at least one value, in ascending order.
+		Keys() []string
+
+		// KeysOf returns all keys that have value, in ascending order.
+		KeysOf(value T) []string
+
+		// Find traverses the values of all keys and returns the first one that satisfies the provided predicate function.
+		// If no value is found, the bool result will be false.
+		Find(func(T) bool) (value T, found bool)
+
+		// Len returns the number of keys.
+		Len() int
+
+		// Save persists the current state of the MultiMap.
+		// It returns an error if the save operation fails.
+		Save() error
+
+		// Lock acquires the write lock for the data store to allow safe updates.
+		// Don't forget to use Unlock when you are done.
+		Lock()
+
+		// Unlock releases the write lock for the data store.
+		Unlock()
+
+		// RLock acquires the read lock for the data store to allow safe reading.
+		// Don't forget to use RUnlock when you are done.
+		RLock()
+
+		// RUnlock releases the read lock for the data store.
+		RUnlock()
+	}
+)
+
+func (m *memoryMultiMap[T]) Add(key string, value T) bool {
+	if m.Contains(key, value) {
+		return false
+	}
+	m.data[key] = append(m.data[key], value)
+	keys, ok := m.reverse[value]
+	if !ok {
+		keys = make(map[string]struct{})
+		m.reverse[value] = keys
+	}
+	keys[key] = struct{}{}
+	return true
+}
+
+func (m *memoryMultiMap[T]) RemoveValue(key string, value T) bool {
+	if !m.Contains(key, value) {
+		return false
+	}
+	values := slices.DeleteFunc(m.data[key], func(v T) bool {
+		return v == value
+	})
+	if len(values) == 0 {
+		delete(m.data, key)
+	} else {
+		m.data[key] = values
+	}
+	m.unlink(key, value)
+	return true
+}
+
+func (m *memoryMultiMap[T]) Delete(key string) {
+	for _, value := range m.data[key] {
+		m.unlink(key, value)
+	}
+	delete(m.data, key)
+}
+
+// unlink removes key from the reverse lookup of value.
+func (m *memoryMultiMap[T]) unlink(key string, value T) {
+	keys := m.reverse[value]
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(m.reverse, value)
+	}
+}
+
+func (m *memoryMultiMap[T]) GetAll(key string) []T {
+	return slices.Clone(m.data[key])
+}
+
+func (m *memoryMultiMap[T]) Contains(key string, value T) bool {
+	_, ok := m.reverse[value][key]
+	return ok
+}
+
+func (m *memoryMultiMap[T]) Keys() []string {
+	keys := make([]string, 0, len(m.data))
+	for key := range m.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *memoryMultiMap[T]) KeysOf(value T) []string {
+	keys := make([]string, 0, len(m.reverse[value]))
+	for key := range m.reverse[value] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *memoryMultiMap[T]) Find(f func(T) bool) (value T, found bool) {
+	for _, values := range m.data {
+		for _, value = range values {
+			if f(value) {
+				found = true
+				return
+			}
+		}
+	}
+	found = false
+	return
+}
+
+func (m *memoryMultiMap[T]) Len() int {
+	return len(m.data)
+}
+
+func (m *memoryMultiMap[T]) Lock() {
+	m.mut.Lock()
+}
+
+func (m *memoryMultiMap[T]) Unlock() {
+	m.mut.Unlock()
+	notifyChanged(m)
+}
+
+func (m *memoryMultiMap[T]) RLock() {
+	m.mut.RLock()
+}
+
+func (m *memoryMultiMap[T]) RUnlock() {
+	m.mut.RUnlock()
+}
+
+func (m *memoryMultiMap[T]) Save() error {
+	m.RLock()
+	defer m.RUnlock()
+
+	return saveFile(m.location, codecOf(m.location), m.data)
+}
+
+func LoadMultiMap[T comparable](location string) (MultiMap[T], error) {
+	if c, ok := codecFor(location); ok {
+		if m, err := loadMultiMapFromFile[T](location, c); err != nil {
+			return nil, errors.Join(fmt.Errorf("unable to load multimap from file '%s'", location), err)
+		} else {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to find loader for '%s'", location)
+}
+
+func loadMultiMapFromFile[T comparable](location string, c Codec) (MultiMap[T], error) {
+	m := &memoryMultiMap[T]{
+		location: location,
+		data:     make(map[string][]T),
+		reverse:  make(map[T]map[string]struct{}),
+	}
+	var data map[string][]T
+	if _, err := loadFile(location, c, &data); err != nil {
+		return nil, err
+	}
+	for key, values := range data {
+		for _, value := range values {
+			m.Add(key, value)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,131 @@
+package speicher
+
+import (
+	"time"
+)
+
+type (
+	// Option configures how a data store is loaded.
+	Option func(*options)
+
+	options struct {
+		ordered           bool
+		visibilityTimeout time.Duration
+		segmentDuration   time.Duration
+		retention         time.Duration
+		maxLen            int
+		cacheSize         int
+		maxEntries        int
+		maxBytes          int64
+		logSize           int
+		lock              bool
+	}
+)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		visibilityTimeout: 30 * time.Second,
+		segmentDuration:   24 * time.Hour,
+		cacheSize:         1024,
+		logSize:           defaultLogSize,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Ordered makes LoadMap return an OrderedMap that keeps its keys sorted.
+// Iterating an ordered map always yields the elements in ascending key order.
+func Ordered() Option {
+	return func(o *options) {
+		o.ordered = true
+	}
+}
+
+// WithVisibilityTimeout sets how long an element taken from a Queue stays hidden
+// from other consumers before it is delivered again if it was not acknowledged.
+// The default is 30 seconds.
+func WithVisibilityTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.visibilityTimeout = d
+	}
+}
+
+// WithSegmentDuration sets the time span covered by one segment file of a TimeSeries.
+// The default is one day.
+func WithSegmentDuration(d time.Duration) Option {
+	return func(o *options) {
+		o.segmentDuration = d
+	}
+}
+
+// WithRetention makes a TimeSeries drop segments whose points are all older than d.
+// By default no segments are dropped.
+func WithRetention(d time.Duration) Option {
+	return func(o *options) {
+		o.retention = d
+	}
+}
+
+// WithMaxLen caps a List at n elements.
+// Appending to a full List evicts its oldest (first) elements.
+// By default a List is not capped.
+func WithMaxLen(n int) Option {
+	return func(o *options) {
+		o.maxLen = n
+	}
+}
+
+// WithCacheSize sets how many values a Map loaded from a ".jsonl" file keeps in memory.
+// The least recently used values are dropped from memory first.
+// The default is 1024.
+func WithCacheSize(n int) Option {
+	return func(o *options) {
+		o.cacheSize = n
+	}
+}
+
+// WithMaxEntries caps a Cache at n entries.
+// Adding to a full Cache evicts its least recently used entries.
+func WithMaxEntries(n int) Option {
+	return func(o *options) {
+		o.maxEntries = n
+	}
+}
+
+// WithMaxBytes caps the total size of the entries of a Cache at n bytes.
+// The size of an entry is the length of its key plus the length of the JSON encoding of its value.
+// Adding to a full Cache evicts its least recently used entries.
+func WithMaxBytes(n int64) Option {
+	return func(o *options) {
+		o.maxBytes = n
+	}
+}
+
+// WithLogSize sets how many changes a Primary keeps for followers that reconnect.
+// A follower that is further behind gets the full state of all data stores instead.
+// The default is 10000.
+func WithLogSize(n int) Option {
+	return func(o *options) {
+		o.logSize = max(n, 1)
+	}
+}
+
+// WithLock makes LoadMap and LoadList lock the file with LockFile, so other processes that respect the lock,
+// like the speicher command, don't change it while it is in use.
+// The lock is held until the process exits. Loading fails with ErrLocked if another process holds it.
+func WithLock() Option {
+	return func(o *options) {
+		o.lock = true
+	}
+}
+
+// lockFile locks the file at location if WithLock is set.
+// Otherwise it returns a nil lock, which can be released as well.
+func (o *options) lockFile(location string) (*FileLock, error) {
+	if !o.lock {
+		return nil, nil
+	}
+	return LockFile(location)
+}
@@ -0,0 +1,135 @@
+package speicher
+
+import (
+	"iter"
+	"strings"
+	"time"
+)
+
+type (
+	// orderedMap is a memoryMap that keeps its keys sorted.
+	orderedMap[T any] struct {
+		*memoryMap[T]
+	}
+
+	// OrderedMap is a Map that keeps its keys in ascending order.
+	// Use LoadMap with the Ordered option to get one.
+	// All methods that iterate the map (RangeKV, RangeV, Find, FindAll) follow the key order.
+	OrderedMap[T any] interface {
+		Map[T]
+
+		// Ascend returns a read-only channel that emits all elements in ascending key order,
+		// along with a cancellation function to terminate the iteration.
+		Ascend() (<-chan MapRangeEl[T], func())
+
+		// Descend returns a read-only channel that emits all elements in descending key order,
+		// along with a cancellation function to terminate the iteration.
+		Descend() (<-chan MapRangeEl[T], func())
+
+		// Range returns a read-only channel that emits the elements with from <= key < to in ascending key order,
+		// along with a cancellation function to terminate the iteration.
+		// An empty to means there is no upper bound.
+		Range(from, to string) (<-chan MapRangeEl[T], func())
+
+		// Prefix returns a read-only channel that emits the elements whose key starts with p in ascending key order,
+		// along with a cancellation function to terminate the iteration.
+		Prefix(p string) (<-chan MapRangeEl[T], func())
+
+		// First returns the element with the smallest key.
+		// If the map is empty, the bool result will be false.
+		First() (MapRangeEl[T], bool)
+
+		// Last returns the element with the largest key.
+		// If the map is empty, the bool result will be false.
+		Last() (MapRangeEl[T], bool)
+
+		// Seek returns the first element whose key is greater than or equal to key.
+		// If there is no such element, the bool result will be false.
+		Seek(key string) (MapRangeEl[T], bool)
+	}
+)
+
+func orderKeys(keys iter.Seq[string]) *skipList {
+	s := newSkipList()
+	for key := range keys {
+		s.insert(key)
+	}
+	return s
+}
+
+// el returns the element of the first node from n on that has not expired,
+// walking backwards if backward is set.
+func (m *orderedMap[T]) el(n *skipNode, backward bool) (MapRangeEl[T], bool) {
+	now := time.Now()
+	for n != nil && m.expired(n.key, now) {
+		if backward {
+			n = n.prev
+		} else {
+			n = n.next[0]
+		}
+	}
+	if n == nil {
+		return MapRangeEl[T]{}, false
+	}
+	value, _ := m.data.get(n.key)
+	return MapRangeEl[T]{Key: n.key, Value: value}, true
+}
+
+// ascendWhile emits the elements starting at n for as long as keep returns true.
+func (m *orderedMap[T]) ascendWhile(n *skipNode, keep func(key string) bool) (<-chan MapRangeEl[T], func()) {
+	return emit(func(yield func(MapRangeEl[T]) bool) {
+		now := time.Now()
+		for ; n != nil && keep(n.key); n = n.next[0] {
+			if m.expired(n.key, now) {
+				continue
+			}
+			value, _ := m.data.get(n.key)
+			if !yield(MapRangeEl[T]{Key: n.key, Value: value}) {
+				return
+			}
+		}
+	})
+}
+
+func (m *orderedMap[T]) Ascend() (<-chan MapRangeEl[T], func()) {
+	return m.ascendWhile(m.order.first(), func(string) bool { return true })
+}
+
+func (m *orderedMap[T]) Descend() (<-chan MapRangeEl[T], func()) {
+	return emit(func(yield func(MapRangeEl[T]) bool) {
+		now := time.Now()
+		for n := m.order.last(); n != nil; n = n.prev {
+			if m.expired(n.key, now) {
+				continue
+			}
+			value, _ := m.data.get(n.key)
+			if !yield(MapRangeEl[T]{Key: n.key, Value: value}) {
+				return
+			}
+		}
+	})
+}
+
+func (m *orderedMap[T]) Range(from, to string) (<-chan MapRangeEl[T], func()) {
+	return m.ascendWhile(m.order.seek(from), func(key string) bool {
+		return to == "" || key < to
+	})
+}
+
+func (m *orderedMap[T]) Prefix(p string) (<-chan MapRangeEl[T], func()) {
+	return m.ascendWhile(m.order.seek(p), func(key string) bool {
+		return strings.HasPrefix(key, p)
+	})
+}
+
+func (m *orderedMap[T]) First() (MapRangeEl[T], bool) {
+	return m.el(m.order.first(), false)
+}
+
+func (m *orderedMap[T]) Last() (MapRangeEl[T], bool) {
+	return m.el(m.order.last(), true)
+}
+
+func (m *orderedMap[T]) Seek(key string) (MapRangeEl[T], bool) {
+	return m.el(m.order.seek(key), false)
+}
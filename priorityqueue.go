@@ -0,0 +1,269 @@
+package speicher
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// memoryPriorityQueue is a PriorityQueue implementation that keeps all elements in memory.
+	// Elements wait in delayed until they are due and are then moved to ready.
+	memoryPriorityQueue[T any] struct {
+		delayed  pqHeap[T]
+		ready    pqHeap[T]
+		nextSeq  uint64
+		location string
+		mut      sync.RWMutex
+		// wake is closed and replaced whenever an element is pushed.
+		wake chan struct{}
+		// promotedAt is the latest time passed to promote.
+		promotedAt time.Time
+
+		saveState
+	}
+
+	// priorityQueueData is the persisted state of a memoryPriorityQueue.
+	priorityQueueData[T any] struct {
+		NextSeq uint64       `json:"nextSeq"`
+		Items   []pqEntry[T] `json:"items"`
+	}
+
+	pqEntry[T any] struct {
+		Seq      uint64    `json:"seq"`
+		Value    T         `json:"value"`
+		Priority int       `json:"priority"`
+		Due      time.Time `json:"due"`
+	}
+
+	// pqHeap implements heap.Interface for pqEntry using less.
+	pqHeap[T any] struct {
+		entries []pqEntry[T]
+		less    func(a, b pqEntry[T]) bool
+	}
+
+	// PriorityItem is an element taken from a PriorityQueue.
+	PriorityItem[T any] struct {
+		Value    T
+		Priority int
+		Due      time.Time
+	}
+
+	// PriorityQueue is a thread-safe, persistent data store interface for scheduled work.
+	// Every element has a priority and a due time. An element is ready once its due time has passed.
+	// Ready elements are taken by highest priority first, then by earliest due time, then in the order they were pushed.
+	PriorityQueue[T any] interface {
+		// Push adds value to the PriorityQueue.
+		// It is ready at due; pass the zero time to make it ready right away.
+		Push(value T, priority int, due time.Time)
+
+		// PopReady takes the ready element with the highest priority at the given time.
+		// If no element is ready, the bool result will be false.
+		PopReady(now time.Time) (PriorityItem[T], bool)
+
+		// NextDue returns the time at which the next element is ready.
+		// The time is in the past if an element is ready already.
+		// If the PriorityQueue is empty, the bool result will be false.
+		NextDue() (time.Time, bool)
+
+		// WaitReady is like PopReady but waits until an element is ready or ctx is done.
+		// It acquires the lock itself, so don't hold the lock while calling it.
+		WaitReady(ctx context.Context) (PriorityItem[T], error)
+
+		// Len returns the number of elements in the PriorityQueue, ready or not.
+		Len() int
+
+		// Save persists the current state of the PriorityQueue to its underlying data store.
+		// It returns an error if the operation fails.
+		Save() error
+
+		// Lock acquires an exclusive lock on the PriorityQueue to ensure thread-safe operations.
+		// Don't forget to use Unlock when you are done.
+		Lock()
+
+		// Unlock releases the exclusive lock previously acquired with Lock.
+		Unlock()
+
+		// RLock acquires a read lock on the PriorityQueue to allow concurrent read operations.
+		// Don't forget to use RUnlock when you are done.
+		RLock()
+
+		// RUnlock releases the read lock acquired with RLock.
+		RUnlock()
+	}
+)
+
+func (h *pqHeap[T]) Len() int           { return len(h.entries) }
+func (h *pqHeap[T]) Less(i, j int) bool { return h.less(h.entries[i], h.entries[j]) }
+func (h *pqHeap[T]) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *pqHeap[T]) Push(x any)         { h.entries = append(h.entries, x.(pqEntry[T])) }
+func (h *pqHeap[T]) Pop() any {
+	e := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return e
+}
+
+func dueLess[T any](a, b pqEntry[T]) bool {
+	if !a.Due.Equal(b.Due) {
+		return a.Due.Before(b.Due)
+	}
+	return a.Seq < b.Seq
+}
+
+func priorityLess[T any](a, b pqEntry[T]) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return dueLess(a, b)
+}
+
+func (q *memoryPriorityQueue[T]) Push(value T, priority int, due time.Time) {
+	q.nextSeq++
+	heap.Push(&q.delayed, pqEntry[T]{Seq: q.nextSeq, Value: value, Priority: priority, Due: due})
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+// promote moves all elements that are due at now from delayed to ready.
+// If an earlier call used a later time, the elements that are not due at now are moved back first.
+func (q *memoryPriorityQueue[T]) promote(now time.Time) {
+	if now.Before(q.promotedAt) {
+		ready := q.ready.entries[:0]
+		for _, e := range q.ready.entries {
+			if e.Due.After(now) {
+				heap.Push(&q.delayed, e)
+			} else {
+				ready = append(ready, e)
+			}
+		}
+		clear(q.ready.entries[len(ready):])
+		q.ready.entries = ready
+		heap.Init(&q.ready)
+	}
+	q.promotedAt = now
+	for q.delayed.Len() > 0 && !q.delayed.entries[0].Due.After(now) {
+		heap.Push(&q.ready, heap.Pop(&q.delayed))
+	}
+}
+
+func (q *memoryPriorityQueue[T]) PopReady(now time.Time) (PriorityItem[T], bool) {
+	q.promote(now)
+	if q.ready.Len() == 0 {
+		return PriorityItem[T]{}, false
+	}
+	e := heap.Pop(&q.ready).(pqEntry[T])
+	return PriorityItem[T]{Value: e.Value, Priority: e.Priority, Due: e.Due}, true
+}
+
+func (q *memoryPriorityQueue[T]) NextDue() (time.Time, bool) {
+	var next time.Time
+	found := false
+	if q.delayed.Len() > 0 {
+		next, found = q.delayed.entries[0].Due, true
+	}
+	// ready is ordered by priority, so its earliest due time has to be searched
+	for _, e := range q.ready.entries {
+		if !found || e.Due.Before(next) {
+			next, found = e.Due, true
+		}
+	}
+	return next, found
+}
+
+func (q *memoryPriorityQueue[T]) WaitReady(ctx context.Context) (PriorityItem[T], error) {
+	for {
+		// not Lock and Unlock, which would schedule a save even if nothing was taken
+		q.mut.Lock()
+		item, ok := q.PopReady(time.Now())
+		next, hasNext := q.NextDue()
+		wake := q.wake
+		q.mut.Unlock()
+		if ok {
+			notifyChanged(q)
+			return item, nil
+		}
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if hasNext {
+			timer = time.NewTimer(time.Until(next))
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return PriorityItem[T]{}, err
+		}
+	}
+}
+
+func (q *memoryPriorityQueue[T]) Len() int {
+	return q.delayed.Len() + q.ready.Len()
+}
+
+func (q *memoryPriorityQueue[T]) Lock() {
+	q.mut.Lock()
+}
+
+func (q *memoryPriorityQueue[T]) Unlock() {
+	q.mut.Unlock()
+	notifyChanged(q)
+}
+
+func (q *memoryPriorityQueue[T]) RLock() {
+	q.mut.RLock()
+}
+
+func (q *memoryPriorityQueue[T]) RUnlock() {
+	q.mut.RUnlock()
+}
+
+func (q *memoryPriorityQueue[T]) Save() error {
+	q.RLock()
+	defer q.RUnlock()
+
+	data := priorityQueueData[T]{NextSeq: q.nextSeq}
+	data.Items = append(data.Items, q.ready.entries...)
+	data.Items = append(data.Items, q.delayed.entries...)
+	sort.Slice(data.Items, func(i, j int) bool {
+		return data.Items[i].Seq < data.Items[j].Seq
+	})
+	return saveFile(q.location, codecOf(q.location), data)
+}
+
+func LoadPriorityQueue[T any](location string) (PriorityQueue[T], error) {
+	if c, ok := codecFor(location); ok {
+		if q, err := loadPriorityQueueFromFile[T](location, c); err != nil {
+			return nil, errors.Join(fmt.Errorf("unable to load priority queue from file '%s'", location), err)
+		} else {
+			return q, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to find loader for '%s'", location)
+}
+
+func loadPriorityQueueFromFile[T any](location string, c Codec) (PriorityQueue[T], error) {
+	var data priorityQueueData[T]
+	if _, err := loadFile(location, c, &data); err != nil {
+		return nil, err
+	}
+	q := &memoryPriorityQueue[T]{
+		delayed:  pqHeap[T]{entries: data.Items, less: dueLess[T]},
+		ready:    pqHeap[T]{less: priorityLess[T]},
+		nextSeq:  data.NextSeq,
+		location: location,
+		wake:     make(chan struct{}),
+	}
+	heap.Init(&q.delayed)
+	return q, nil
+}
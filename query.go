@@ -0,0 +1,353 @@
+package speicher
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// queryParams holds the conditions shared by Query and MapQuery.
+	queryParams[T any] struct {
+		where  []func(T) bool
+		less   func(a, b T) bool
+		offset int
+		limit  int
+	}
+
+	// Query selects, sorts and slices the elements of a List.
+	// Create one with List.Query and read the result with Collect.
+	Query[T any] struct {
+		queryParams[T]
+		list *memoryList[T]
+	}
+
+	// MapQuery selects, sorts and slices the elements of a Map.
+	// Create one with Map.Query and read the result with Collect, CollectKV or Page.
+	// Without OrderBy the elements are sorted by key.
+	// With OrderBy, elements that are neither less nor greater than each other are sorted by key.
+	MapQuery[T any] struct {
+		queryParams[T]
+		m *memoryMap[T]
+		// sortKey is set by OrderMapBy.
+		sortKey *mapSortKey[T]
+	}
+
+	// mapSortKey is the sort key of a MapQuery, which is all a page cursor needs besides the key.
+	mapSortKey[T any] struct {
+		encode func(T) (json.RawMessage, error)
+		// decode returns a function that compares the decoded sort key with the one of a value.
+		decode func(json.RawMessage) (func(T) int, error)
+	}
+
+	// MapPage is one page of the result of a MapQuery.
+	MapPage[T any] struct {
+		Elements []MapRangeEl[T]
+		// Next is the cursor of the following page.
+		// It is empty if there are no more elements.
+		Next string
+	}
+
+	// mapCursor is the decoded form of a MapPage cursor.
+	// It holds the position of the last element of a page, so that paging does not depend on
+	// the element still being stored when the next page is requested:
+	// the key, and the sort key with OrderMapBy.
+	mapCursor struct {
+		Key  string          `json:"k"`
+		Sort json.RawMessage `json:"s,omitempty"`
+	}
+)
+
+func (p *queryParams[T]) match(value T) bool {
+	for _, f := range p.where {
+		if !f(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// window returns the bounds of the result slice after applying offset and limit to n elements.
+func (p *queryParams[T]) window(n int) (int, int) {
+	lo := min(p.offset, n)
+	hi := n
+	if p.limit >= 0 {
+		hi = min(lo+p.limit, n)
+	}
+	return lo, hi
+}
+
+func (l *memoryList[T]) Query() *Query[T] {
+	return &Query[T]{queryParams: queryParams[T]{limit: -1}, list: l}
+}
+
+// Where adds a predicate that the elements must satisfy.
+// Multiple predicates must all be satisfied.
+func (q *Query[T]) Where(f func(T) bool) *Query[T] {
+	q.where = append(q.where, f)
+	return q
+}
+
+// OrderBy sorts the elements using less.
+// Elements that are neither less nor greater than each other keep their List order.
+func (q *Query[T]) OrderBy(less func(a, b T) bool) *Query[T] {
+	q.less = less
+	return q
+}
+
+// Offset skips the first n elements of the result.
+func (q *Query[T]) Offset(n int) *Query[T] {
+	q.offset = max(n, 0)
+	return q
+}
+
+// Limit returns at most n elements.
+func (q *Query[T]) Limit(n int) *Query[T] {
+	q.limit = max(n, 0)
+	return q
+}
+
+// Collect runs the query and returns the matching elements.
+// Hold at least the read lock of the List while calling it.
+func (q *Query[T]) Collect() []T {
+	var values []T
+	for _, value := range q.list.data {
+		if q.match(value) {
+			values = append(values, value)
+		}
+	}
+	if q.less != nil {
+		sort.SliceStable(values, func(i, j int) bool {
+			return q.less(values[i], values[j])
+		})
+	}
+	lo, hi := q.window(len(values))
+	return values[lo:hi]
+}
+
+func (m *memoryMap[T]) Query() *MapQuery[T] {
+	return &MapQuery[T]{queryParams: queryParams[T]{limit: -1}, m: m}
+}
+
+// Where adds a predicate that the elements must satisfy.
+// Multiple predicates must all be satisfied.
+func (q *MapQuery[T]) Where(f func(T) bool) *MapQuery[T] {
+	q.where = append(q.where, f)
+	return q
+}
+
+// OrderBy sorts the elements using less instead of by key.
+// Page needs a sort key to continue from, so use OrderMapBy for paging.
+func (q *MapQuery[T]) OrderBy(less func(a, b T) bool) *MapQuery[T] {
+	q.less = less
+	q.sortKey = nil
+	return q
+}
+
+// OrderMapBy sorts the elements of q by the sort key returned by key instead of by key.
+// The cursors of Page only hold the sort key and the key of the last element.
+func OrderMapBy[T any, K cmp.Ordered](q *MapQuery[T], key func(T) K) *MapQuery[T] {
+	q.less = func(a, b T) bool {
+		return cmp.Less(key(a), key(b))
+	}
+	q.sortKey = &mapSortKey[T]{
+		encode: func(value T) (json.RawMessage, error) {
+			return json.Marshal(key(value))
+		},
+		decode: func(b json.RawMessage) (func(T) int, error) {
+			var k K
+			if err := json.Unmarshal(b, &k); err != nil {
+				return nil, err
+			}
+			return func(value T) int {
+				return cmp.Compare(k, key(value))
+			}, nil
+		},
+	}
+	return q
+}
+
+// Offset skips the first n elements of the result.
+func (q *MapQuery[T]) Offset(n int) *MapQuery[T] {
+	q.offset = max(n, 0)
+	return q
+}
+
+// Limit returns at most n elements.
+// For Page it is the page size.
+func (q *MapQuery[T]) Limit(n int) *MapQuery[T] {
+	q.limit = max(n, 0)
+	return q
+}
+
+// compare orders two elements by the OrderBy function first and by key second.
+func (q *MapQuery[T]) compare(a, b MapRangeEl[T]) int {
+	if q.less != nil {
+		if q.less(a.Value, b.Value) {
+			return -1
+		}
+		if q.less(b.Value, a.Value) {
+			return 1
+		}
+	}
+	return strings.Compare(a.Key, b.Key)
+}
+
+// need returns how many sorted elements window needs to tell if there are more, or -1 for all of them.
+func (p *queryParams[T]) need() int {
+	if p.limit < 0 {
+		return -1
+	}
+	return p.offset + p.limit + 1
+}
+
+// run returns the sorted matching elements.
+// If after is not nil, only the elements after the position it compares them with are returned;
+// from is the key of that position.
+func (q *MapQuery[T]) run(after func(el MapRangeEl[T]) int, from string) []MapRangeEl[T] {
+	if q.less == nil {
+		return q.runByKey(after, from)
+	}
+	var els []MapRangeEl[T]
+	for key, value := range q.m.all() {
+		el := MapRangeEl[T]{Key: key, Value: value}
+		if after != nil && after(el) >= 0 {
+			continue
+		}
+		if q.match(value) {
+			els = append(els, el)
+		}
+	}
+	sort.Slice(els, func(i, j int) bool {
+		return q.compare(els[i], els[j]) < 0
+	})
+	return els
+}
+
+// runByKey is run for a query in key order.
+// It walks the keys starting at from and stops once it has as many elements as needed.
+func (q *MapQuery[T]) runByKey(after func(el MapRangeEl[T]) int, from string) []MapRangeEl[T] {
+	var els []MapRangeEl[T]
+	need := q.need()
+	now := time.Now()
+	for key := range q.m.keysFrom(from) {
+		if need >= 0 && len(els) >= need {
+			break
+		}
+		if q.m.expired(key, now) {
+			continue
+		}
+		value, _ := q.m.data.get(key)
+		el := MapRangeEl[T]{Key: key, Value: value}
+		if after != nil && after(el) >= 0 {
+			continue
+		}
+		if q.match(value) {
+			els = append(els, el)
+		}
+	}
+	return els
+}
+
+// CollectKV runs the query and returns the matching key-value pairs.
+// Hold at least the read lock of the Map while calling it.
+func (q *MapQuery[T]) CollectKV() []MapRangeEl[T] {
+	els := q.run(nil, "")
+	lo, hi := q.window(len(els))
+	return els[lo:hi]
+}
+
+// Collect runs the query and returns the matching elements.
+// Hold at least the read lock of the Map while calling it.
+func (q *MapQuery[T]) Collect() []T {
+	els := q.CollectKV()
+	values := make([]T, len(els))
+	for i, el := range els {
+		values[i] = el.Value
+	}
+	return values
+}
+
+// Page runs the query and returns the page that follows cursor.
+// Pass an empty cursor to get the first page and MapPage.Next to get the following ones.
+// Limit is the page size and Offset skips elements after the cursor.
+// Pages stay stable when elements are added or removed between calls:
+// no element is returned twice and no unchanged element is skipped.
+// In key order, only the keys of the requested page are walked.
+// It returns an error for a query sorted with OrderBy, use OrderMapBy instead.
+// Hold at least the read lock of the Map while calling it.
+func (q *MapQuery[T]) Page(cursor string) (MapPage[T], error) {
+	if q.less != nil && q.sortKey == nil {
+		return MapPage[T]{}, errors.New("unable to page a query sorted with OrderBy, use OrderMapBy")
+	}
+	var after func(el MapRangeEl[T]) int
+	var from string
+	if cursor != "" {
+		var err error
+		if after, from, err = q.decodeCursor(cursor); err != nil {
+			return MapPage[T]{}, errors.Join(fmt.Errorf("invalid cursor '%s'", cursor), err)
+		}
+	}
+	els := q.run(after, from)
+	lo, hi := q.window(len(els))
+	page := MapPage[T]{Elements: els[lo:hi]}
+	if hi < len(els) && hi > lo {
+		next, err := q.encodeCursor(page.Elements[len(page.Elements)-1])
+		if err != nil {
+			return MapPage[T]{}, err
+		}
+		page.Next = next
+	}
+	return page, nil
+}
+
+func (q *MapQuery[T]) encodeCursor(el MapRangeEl[T]) (string, error) {
+	c := mapCursor{Key: el.Key}
+	if q.sortKey != nil {
+		var err error
+		if c.Sort, err = q.sortKey.encode(el.Value); err != nil {
+			return "", errors.Join(fmt.Errorf("failed to encode cursor for key '%s'", el.Key), err)
+		}
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("failed to encode cursor for key '%s'", el.Key), err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor returns a function that compares the position in cursor with an element
+// and the key of the position.
+func (q *MapQuery[T]) decodeCursor(cursor string) (func(el MapRangeEl[T]) int, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	var c mapCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, "", err
+	}
+	if q.sortKey != nil {
+		if c.Sort == nil {
+			return nil, "", errors.New("missing sort key")
+		}
+		compareSort, err := q.sortKey.decode(c.Sort)
+		if err != nil {
+			return nil, "", err
+		}
+		return func(el MapRangeEl[T]) int {
+			if n := compareSort(el.Value); n != 0 {
+				return n
+			}
+			return strings.Compare(c.Key, el.Key)
+		}, c.Key, nil
+	}
+	return func(el MapRangeEl[T]) int {
+		return strings.Compare(c.Key, el.Key)
+	}, c.Key, nil
+}
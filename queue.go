@@ -0,0 +1,298 @@
+package speicher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRedelivered is returned by Ack and Nack for the receipt of an earlier delivery of an element,
+// which was delivered again because its visibility timeout passed.
+var ErrRedelivered = errors.New("queue element was delivered again")
+
+type (
+	// memoryQueue is a Queue implementation that keeps all elements in memory.
+	memoryQueue[T any] struct {
+		data              queueData[T]
+		location          string
+		visibilityTimeout time.Duration
+		mut               sync.RWMutex
+		// wake is closed and replaced whenever an element becomes available.
+		wake chan struct{}
+
+		saveState
+	}
+
+	// queueData is the persisted state of a memoryQueue.
+	queueData[T any] struct {
+		NextID uint64         `json:"nextId"`
+		Items  []queueItem[T] `json:"items"`
+	}
+
+	queueItem[T any] struct {
+		ID       uint64 `json:"id"`
+		Value    T      `json:"value"`
+		Attempts int    `json:"attempts"`
+		// LeasedUntil is the time until which the element is hidden from consumers.
+		LeasedUntil time.Time `json:"leasedUntil"`
+	}
+
+	// QueueItem is an element taken from a Queue.
+	// Acknowledge it with Queue.Ack once it was processed.
+	QueueItem[T any] struct {
+		ID    uint64
+		Value T
+		// Attempts is the number of times the element was delivered, including this one.
+		Attempts int
+		// Receipt identifies this delivery of the element for Ack and Nack.
+		Receipt string
+	}
+
+	// Queue is a thread-safe, persistent FIFO queue data store interface.
+	// Elements taken with Dequeue stay in the queue, hidden from other consumers,
+	// until they are acknowledged with Ack. If they are not acknowledged within the
+	// visibility timeout (see WithVisibilityTimeout), they are delivered again.
+	// This gives at-least-once processing, even across restarts.
+	Queue[T any] interface {
+		// Enqueue adds the provided value to the end of the Queue.
+		Enqueue(value T)
+
+		// Dequeue takes the first visible element of the Queue and hides it for the visibility timeout.
+		// If no element is visible, the bool result will be false.
+		Dequeue() (QueueItem[T], bool)
+
+		// DequeueContext is like Dequeue but waits until an element is visible or ctx is done.
+		// It acquires the lock itself, so don't hold the lock while calling it.
+		DequeueContext(ctx context.Context) (QueueItem[T], error)
+
+		// Peek returns the value of the first visible element without taking it.
+		// If no element is visible, the bool result will be false.
+		Peek() (T, bool)
+
+		// Ack removes an element taken with Dequeue from the Queue, given the Receipt of its QueueItem.
+		// It returns an error if the element is not in the Queue,
+		// and ErrRedelivered if it was delivered again since.
+		Ack(receipt string) error
+
+		// Nack makes an element taken with Dequeue visible again right away, given the Receipt of its QueueItem.
+		// It returns an error if the element is not in the Queue,
+		// and ErrRedelivered if it was delivered again since.
+		Nack(receipt string) error
+
+		// Len returns the number of elements that were not acknowledged yet, including hidden ones.
+		Len() int
+
+		// Save persists the current state of the Queue to its underlying data store.
+		// It returns an error if the operation fails.
+		Save() error
+
+		// Lock acquires an exclusive lock on the Queue to ensure thread-safe operations.
+		// Don't forget to use Unlock when you are done.
+		Lock()
+
+		// Unlock releases the exclusive lock previously acquired with Lock.
+		Unlock()
+
+		// RLock acquires a read lock on the Queue to allow concurrent read operations.
+		// Don't forget to use RUnlock when you are done.
+		RLock()
+
+		// RUnlock releases the read lock acquired with RLock.
+		RUnlock()
+	}
+)
+
+// signal wakes up all consumers waiting in DequeueContext.
+func (q *memoryQueue[T]) signal() {
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+// visible returns the index of the first element that is not hidden.
+func (q *memoryQueue[T]) visible(now time.Time) int {
+	for i, item := range q.data.Items {
+		if !item.LeasedUntil.After(now) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *memoryQueue[T]) index(id uint64) int {
+	for i, item := range q.data.Items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// receipt returns the receipt of the current delivery of item.
+func receipt[T any](item queueItem[T]) string {
+	return strconv.FormatUint(item.ID, 10) + "." + strconv.Itoa(item.Attempts)
+}
+
+// delivery returns the index of the element receipt was issued for.
+// It returns an error if the element is gone or was delivered again since.
+func (q *memoryQueue[T]) delivery(receipt string) (int, error) {
+	idPart, attemptPart, _ := strings.Cut(receipt, ".")
+	id, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil {
+		return -1, fmt.Errorf("invalid receipt '%s'", receipt)
+	}
+	attempts, err := strconv.Atoi(attemptPart)
+	if err != nil || attempts < 1 {
+		return -1, fmt.Errorf("invalid receipt '%s'", receipt)
+	}
+	i := q.index(id)
+	if i < 0 {
+		return -1, fmt.Errorf("queue element %d not found", id)
+	}
+	if q.data.Items[i].Attempts != attempts {
+		return -1, errors.Join(fmt.Errorf("receipt '%s' is outdated", receipt), ErrRedelivered)
+	}
+	return i, nil
+}
+
+func (q *memoryQueue[T]) Enqueue(value T) {
+	q.data.NextID++
+	q.data.Items = append(q.data.Items, queueItem[T]{ID: q.data.NextID, Value: value})
+	q.signal()
+}
+
+func (q *memoryQueue[T]) Dequeue() (QueueItem[T], bool) {
+	now := time.Now()
+	i := q.visible(now)
+	if i < 0 {
+		return QueueItem[T]{}, false
+	}
+	item := &q.data.Items[i]
+	item.LeasedUntil = now.Add(q.visibilityTimeout)
+	item.Attempts++
+	return QueueItem[T]{ID: item.ID, Value: item.Value, Attempts: item.Attempts, Receipt: receipt(*item)}, true
+}
+
+func (q *memoryQueue[T]) DequeueContext(ctx context.Context) (QueueItem[T], error) {
+	for {
+		// not Lock and Unlock, which would schedule a save even if nothing was dequeued
+		q.mut.Lock()
+		item, ok := q.Dequeue()
+		wake := q.wake
+		// the earliest time a hidden element becomes visible again
+		var next time.Time
+		for _, hidden := range q.data.Items {
+			if next.IsZero() || hidden.LeasedUntil.Before(next) {
+				next = hidden.LeasedUntil
+			}
+		}
+		q.mut.Unlock()
+		if ok {
+			notifyChanged(q)
+			return item, nil
+		}
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return QueueItem[T]{}, err
+		}
+	}
+}
+
+func (q *memoryQueue[T]) Peek() (value T, found bool) {
+	i := q.visible(time.Now())
+	if i < 0 {
+		found = false
+		return
+	}
+	return q.data.Items[i].Value, true
+}
+
+func (q *memoryQueue[T]) Ack(receipt string) error {
+	i, err := q.delivery(receipt)
+	if err != nil {
+		return err
+	}
+	q.data.Items = append(q.data.Items[:i], q.data.Items[i+1:]...)
+	return nil
+}
+
+func (q *memoryQueue[T]) Nack(receipt string) error {
+	i, err := q.delivery(receipt)
+	if err != nil {
+		return err
+	}
+	q.data.Items[i].LeasedUntil = time.Time{}
+	q.signal()
+	return nil
+}
+
+func (q *memoryQueue[T]) Len() int {
+	return len(q.data.Items)
+}
+
+func (q *memoryQueue[T]) Lock() {
+	q.mut.Lock()
+}
+
+func (q *memoryQueue[T]) Unlock() {
+	q.mut.Unlock()
+	notifyChanged(q)
+}
+
+func (q *memoryQueue[T]) RLock() {
+	q.mut.RLock()
+}
+
+func (q *memoryQueue[T]) RUnlock() {
+	q.mut.RUnlock()
+}
+
+func (q *memoryQueue[T]) Save() error {
+	q.RLock()
+	defer q.RUnlock()
+
+	return saveFile(q.location, codecOf(q.location), q.data)
+}
+
+// LoadQueue loads the Queue stored at location.
+// Use WithVisibilityTimeout to change how long dequeued elements stay hidden.
+func LoadQueue[T any](location string, opts ...Option) (Queue[T], error) {
+	o := newOptions(opts)
+	if c, ok := codecFor(location); ok {
+		if q, err := loadQueueFromFile[T](location, c, o); err != nil {
+			return nil, errors.Join(fmt.Errorf("unable to load queue from file '%s'", location), err)
+		} else {
+			return q, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to find loader for '%s'", location)
+}
+
+func loadQueueFromFile[T any](location string, c Codec, o *options) (Queue[T], error) {
+	q := &memoryQueue[T]{
+		location:          location,
+		visibilityTimeout: o.visibilityTimeout,
+		wake:              make(chan struct{}),
+	}
+	if _, err := loadFile(location, c, &q.data); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
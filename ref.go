@@ -0,0 +1,397 @@
+package speicher
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrRestricted is returned when deleting an element that is still referenced through a Ref with the Restrict policy.
+var ErrRestricted = errors.New("element is still referenced")
+
+// OnDelete is the policy of a Ref for deleting a parent element that is still referenced.
+type OnDelete int
+
+const (
+	// Restrict makes deleting a referenced parent element fail with ErrRestricted.
+	Restrict OnDelete = iota
+	// Cascade deletes the referring child elements along with the parent element.
+	Cascade
+	// Nullify removes the reference from the referring child elements using Ref.Clear.
+	Nullify
+)
+
+type (
+	// Ref declares that the elements of a child Map refer to elements of a parent Map by key,
+	// like orders referring to the user who placed them.
+	Ref[C any] struct {
+		// Name identifies the reference in errors and in the results of CheckRefs.
+		Name string
+		// Key returns the key of the parent element a child element refers to,
+		// or an empty string if it refers to none.
+		Key func(C) string
+		// OnDelete is the policy for deleting a parent element that is still referenced.
+		OnDelete OnDelete
+		// Clear returns the child element without its reference.
+		// It is required for the Nullify policy.
+		Clear func(C) C
+	}
+
+	// DanglingRef is a reference to a parent element that does not exist.
+	DanglingRef struct {
+		// Ref is the name of the reference.
+		Ref string
+		// Key is the key of the child element and Target the missing key it refers to.
+		Key    string
+		Target string
+	}
+
+	// mapRef is a Ref registered at its parent Map, without the element type of the child.
+	mapRef struct {
+		name     string
+		onDelete OnDelete
+		child    refStore
+		// referrers returns the keys of the child elements that refer to key.
+		referrers func(key string) []string
+		// checkNullify returns an error if nullify would fail for the child element with the given key.
+		checkNullify func(key string) error
+		// nullify removes the reference from the child element with the given key.
+		nullify func(key string) error
+		// dangling returns the references of all child elements to keys that has reports as missing.
+		dangling func(has func(key string) bool) []DanglingRef
+	}
+
+	// locker is a data store whose lock may be shared with other data stores.
+	locker interface {
+		// lockID identifies the lock of the store, which is shared by all buckets of a DB.
+		lockID() any
+		Lock()
+		Unlock()
+		RLock()
+		RUnlock()
+	}
+
+	// refStore is a Map that takes part in references, without its element type.
+	refStore interface {
+		locker
+		// refs returns the references to the store.
+		refs() []*mapRef
+		live(key string) bool
+		remove(key string)
+		isFollower() bool
+	}
+
+	// refLocks holds the locks of several data stores, so every lock is acquired only once.
+	refLocks struct {
+		held    map[any]locker
+		write   bool
+		visited map[refVisit]struct{}
+		// deleted holds the elements collected by check, which are deleted by apply.
+		deleted map[refVisit]struct{}
+	}
+
+	refVisit struct {
+		store refStore
+		key   string
+	}
+
+	// refReferrer is an element that refers through a Restrict or Nullify reference to an element being deleted.
+	refReferrer struct {
+		ref *mapRef
+		// key is the key of the deleted element and referrer the key of the element referring to it.
+		key      string
+		referrer string
+	}
+)
+
+// refIndexPrefix is prepended to the name of a Ref for the index that finds the referring child elements.
+const refIndexPrefix = "ref:"
+
+// AddRef registers ref between parent and child.
+// From now on, deleting an element of parent applies the OnDelete policy of ref to the child elements
+// referring to it. The child elements are found through an index named "ref:" followed by the name of ref,
+// which can be used with GetBy as well.
+// Deleting locks the child Maps, so don't hold their locks while deleting from parent,
+// unless they are buckets of the same DB. Avoid references in a cycle between different Maps,
+// because deleting from both ends at once may deadlock.
+// References are not checked on Set, Overwrite, or when elements expire; use CheckRefs to find dangling references.
+// AddRef locks parent and child by itself.
+func AddRef[P, C any](parent Map[P], child Map[C], ref Ref[C]) error {
+	p, ok := asMemoryMap(parent)
+	if !ok {
+		return fmt.Errorf("ref '%s': unsupported parent map", ref.Name)
+	}
+	c, ok := asMemoryMap(child)
+	if !ok {
+		return fmt.Errorf("ref '%s': unsupported child map", ref.Name)
+	}
+	if ref.Key == nil {
+		return fmt.Errorf("ref '%s': missing Key", ref.Name)
+	}
+	if ref.OnDelete == Nullify && ref.Clear == nil {
+		return fmt.Errorf("ref '%s': the Nullify policy requires Clear", ref.Name)
+	}
+
+	locks := newRefLocks(true)
+	locks.lock(p)
+	locks.lock(c)
+	defer locks.unlock()
+
+	for _, r := range p.references {
+		if r.name == ref.Name {
+			return fmt.Errorf("ref '%s' already exists", ref.Name)
+		}
+	}
+	index := refIndexPrefix + ref.Name
+	err := c.createIndex(index, func(value C) []string {
+		if key := ref.Key(value); key != "" {
+			return []string{key}
+		}
+		return nil
+	}, false)
+	if err != nil {
+		return errors.Join(fmt.Errorf("ref '%s': failed to create index", ref.Name), err)
+	}
+
+	p.references = append(p.references, &mapRef{
+		name:     ref.Name,
+		onDelete: ref.OnDelete,
+		child:    c,
+		referrers: func(key string) []string {
+			now := time.Now()
+			var keys []string
+			for _, k := range c.indexes[index].keys(key) {
+				if !c.expired(k, now) {
+					keys = append(keys, k)
+				}
+			}
+			return keys
+		},
+		checkNullify: func(key string) error {
+			value, ok := c.data.get(key)
+			if !ok {
+				return nil
+			}
+			return c.checkSet(key, ref.Clear(value))
+		},
+		nullify: func(key string) error {
+			value, ok := c.data.get(key)
+			if !ok {
+				return nil
+			}
+			value = ref.Clear(value)
+			if err := c.checkSet(key, value); err != nil {
+				return err
+			}
+			// keep the expiration time, which put removes
+			at, expires := c.expires[key]
+			c.put(key, value)
+			if expires {
+				c.expire(key, at)
+			}
+			return nil
+		},
+		dangling: func(has func(key string) bool) []DanglingRef {
+			var dangling []DanglingRef
+			for key, value := range c.all() {
+				if target := ref.Key(value); target != "" && !has(target) {
+					dangling = append(dangling, DanglingRef{Ref: ref.Name, Key: key, Target: target})
+				}
+			}
+			return dangling
+		},
+	})
+	return nil
+}
+
+// CheckRefs reports the child elements of all references registered at parent
+// that refer to a key that does not exist in parent, ordered by reference name and key.
+// It locks parent and the child Maps by itself.
+func CheckRefs[P any](parent Map[P]) []DanglingRef {
+	p, ok := asMemoryMap(parent)
+	if !ok {
+		return nil
+	}
+	locks := newRefLocks(false)
+	locks.lock(p)
+	defer locks.unlock()
+
+	var dangling []DanglingRef
+	for _, r := range p.references {
+		locks.lock(r.child)
+		dangling = append(dangling, r.dangling(p.live)...)
+	}
+	sort.Slice(dangling, func(i, j int) bool {
+		if dangling[i].Ref != dangling[j].Ref {
+			return dangling[i].Ref < dangling[j].Ref
+		}
+		return dangling[i].Key < dangling[j].Key
+	})
+	return dangling
+}
+
+// asMemoryMap returns the memoryMap behind m.
+func asMemoryMap[T any](m Map[T]) (*memoryMap[T], bool) {
+	switch m := m.(type) {
+	case *memoryMap[T]:
+		return m, true
+	case *orderedMap[T]:
+		return m.memoryMap, true
+	}
+	return nil, false
+}
+
+func (m *memoryMap[T]) lockID() any {
+	if m.db != nil {
+		return m.db
+	}
+	return m
+}
+
+func (m *memoryMap[T]) refs() []*mapRef {
+	return m.references
+}
+
+// deleteReferenced deletes key from m and applies the policies of the references to m.
+// The caller holds the write lock of m.
+func (m *memoryMap[T]) deleteReferenced(key string) error {
+	locks := newRefLocks(true)
+	locks.held[m.lockID()] = nil
+	defer locks.unlock()
+
+	if err := locks.check(m, key); err != nil {
+		return err
+	}
+	clear(locks.visited)
+	return locks.apply(m, key)
+}
+
+func newRefLocks(write bool) *refLocks {
+	return &refLocks{
+		held:    make(map[any]locker),
+		write:   write,
+		visited: make(map[refVisit]struct{}),
+		deleted: make(map[refVisit]struct{}),
+	}
+}
+
+// lock acquires the lock of s, unless it is held already.
+func (l *refLocks) lock(s locker) {
+	id := s.lockID()
+	if _, ok := l.held[id]; ok {
+		return
+	}
+	if l.write {
+		s.Lock()
+	} else {
+		s.RLock()
+	}
+	l.held[id] = s
+}
+
+// unlock releases all locks acquired by lock.
+func (l *refLocks) unlock() {
+	for _, s := range l.held {
+		if s == nil {
+			continue
+		}
+		if l.write {
+			s.Unlock()
+		} else {
+			s.RUnlock()
+		}
+	}
+}
+
+// visit reports whether key of s was visited before and marks it as visited.
+func (l *refLocks) visit(s refStore, key string) bool {
+	v := refVisit{store: s, key: key}
+	if _, ok := l.visited[v]; ok {
+		return true
+	}
+	l.visited[v] = struct{}{}
+	return false
+}
+
+// check returns an error if deleting key from s, including the cascade, violates a Restrict policy,
+// reaches a follower or can't clear a Nullify reference.
+// Referrers only matter if they are not deleted by the cascade as well,
+// so all deleted elements are collected before any referrer is checked.
+func (l *refLocks) check(s refStore, key string) error {
+	var referrers []refReferrer
+	if err := l.collect(s, key, &referrers); err != nil {
+		return err
+	}
+	for _, r := range referrers {
+		if l.isDeleted(r.ref.child, r.referrer) {
+			continue
+		}
+		if r.ref.onDelete == Restrict {
+			return errors.Join(fmt.Errorf("ref '%s': key '%s' is referenced by key '%s'", r.ref.name, r.key, r.referrer), ErrRestricted)
+		}
+		if err := r.ref.checkNullify(r.referrer); err != nil {
+			return errors.Join(fmt.Errorf("ref '%s': unable to clear key '%s'", r.ref.name, r.referrer), err)
+		}
+	}
+	return nil
+}
+
+// collect marks key of s and the elements deleted with it by Cascade references as deleted.
+// The elements referring to them through Restrict and Nullify references are appended to referrers.
+func (l *refLocks) collect(s refStore, key string, referrers *[]refReferrer) error {
+	if l.visit(s, key) {
+		return nil
+	}
+	l.deleted[refVisit{store: s, key: key}] = struct{}{}
+	for _, r := range s.refs() {
+		l.lock(r.child)
+		for _, k := range r.referrers(key) {
+			switch r.onDelete {
+			case Restrict, Nullify:
+				*referrers = append(*referrers, refReferrer{ref: r, key: key, referrer: k})
+			case Cascade:
+				if r.child.isFollower() {
+					return errors.Join(fmt.Errorf("ref '%s': unable to delete key '%s'", r.name, k), ErrFollower)
+				}
+				if err := l.collect(r.child, k, referrers); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isDeleted reports whether key of s was collected by check.
+func (l *refLocks) isDeleted(s refStore, key string) bool {
+	_, ok := l.deleted[refVisit{store: s, key: key}]
+	return ok
+}
+
+// apply deletes key from s and applies the policies of the references to s.
+// Elements that are deleted anyway are not cleared.
+func (l *refLocks) apply(s refStore, key string) error {
+	if l.visit(s, key) {
+		return nil
+	}
+	for _, r := range s.refs() {
+		for _, k := range r.referrers(key) {
+			switch r.onDelete {
+			case Cascade:
+				if err := l.apply(r.child, k); err != nil {
+					return err
+				}
+			case Nullify:
+				if l.isDeleted(r.child, k) {
+					continue
+				}
+				if err := r.nullify(k); err != nil {
+					return errors.Join(fmt.Errorf("ref '%s': unable to clear key '%s'", r.name, k), err)
+				}
+			}
+		}
+	}
+	s.remove(key)
+	return nil
+}
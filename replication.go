@@ -0,0 +1,474 @@
+package speicher
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrFollower is returned by the write methods of a data store that follows a primary.
+// Write methods without an error result report it through Err instead.
+var ErrFollower = errors.New("data store is a follower and rejects local writes")
+
+// follows reports whether the data store s follows a primary.
+// The caller holds the lock of s.
+func follows(s any) bool {
+	f, ok := s.(interface{ isFollower() bool })
+	return ok && f.isFollower()
+}
+
+const (
+	// defaultLogSize is the number of changes a Primary keeps for followers to catch up.
+	defaultLogSize = 10000
+	// handshakeTimeout is how long both sides wait for the first message of a connection.
+	handshakeTimeout = 10 * time.Second
+)
+
+// Operations of a replChange.
+const (
+	opSet    = "set"
+	opDelete = "del"
+	opExpire = "expire"
+	opAppend = "append"
+	opTrim   = "trim"
+	opReset  = "reset"
+)
+
+type (
+	// Primary streams the changes of its data stores to followers over TCP.
+	// Register the data stores with ReplicateMap and ReplicateList and accept followers with Serve.
+	// The changes are kept in a log of limited size, so a follower that reconnects continues where it left off.
+	// A follower that fell too far behind, or connects for the first time, gets the full state of all data stores.
+	// All methods are safe for concurrent use.
+	Primary struct {
+		// epoch identifies the change log, which starts over when the process restarts.
+		epoch   string
+		mut     sync.Mutex
+		stores  map[string]primaryStore
+		log     []replChange
+		logSize int
+		seq     uint64
+		// changed is closed and replaced whenever a change is appended to the log.
+		changed   chan struct{}
+		followers map[net.Conn]*FollowerStatus
+	}
+
+	// FollowerStatus is the state of a follower connected to a Primary.
+	FollowerStatus struct {
+		Addr string
+		// Acked is the sequence number of the last change the follower applied.
+		Acked uint64
+	}
+
+	// primaryStore is a replicated data store, without its element type.
+	primaryStore interface {
+		locker
+		// snapshot returns the current state as a reset change.
+		// The caller holds the read lock.
+		snapshot() (replChange, error)
+	}
+
+	// primaryHook is attached to a replicated data store to record its changes.
+	primaryHook struct {
+		p    *Primary
+		name string
+	}
+
+	// replChange is one change of a replicated data store.
+	// It is sent to followers in replMessage.
+	replChange struct {
+		Seq   uint64 `json:"seq"`
+		Store string `json:"store"`
+		Op    string `json:"op"`
+		Key   string `json:"key,omitempty"`
+		// Index is the index for set on a List and the number of elements for trim.
+		Index int             `json:"index,omitempty"`
+		Value json.RawMessage `json:"value,omitempty"`
+		// At is the expiration time for expire, nil to remove it.
+		At *time.Time `json:"at,omitempty"`
+	}
+
+	// replMessage is one line of the replication protocol.
+	// A follower starts with hello, telling the epoch and sequence number it has.
+	// The primary answers with welcome; if Snapshots is not 0, that many reset changes with the
+	// sequence number Seq follow. Then the primary streams the changes after Seq, and the follower
+	// acks every applied change.
+	replMessage struct {
+		Type      string      `json:"type"`
+		Epoch     string      `json:"epoch,omitempty"`
+		Seq       uint64      `json:"seq,omitempty"`
+		Snapshots int         `json:"snapshots,omitempty"`
+		Change    *replChange `json:"change,omitempty"`
+	}
+)
+
+// NewPrimary creates a Primary without any data stores.
+// The WithLogSize option is supported.
+func NewPrimary(opts ...Option) *Primary {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return &Primary{
+		epoch:     hex.EncodeToString(b),
+		stores:    make(map[string]primaryStore),
+		logSize:   newOptions(opts).logSize,
+		changed:   make(chan struct{}),
+		followers: make(map[net.Conn]*FollowerStatus),
+	}
+}
+
+// ReplicateMap registers m under name, so its changes are sent to the followers of p.
+// Followers need a Map registered under the same name with FollowMap.
+// ReplicateMap locks m by itself.
+func ReplicateMap[T any](p *Primary, name string, m Map[T]) error {
+	mm, ok := asMemoryMap(m)
+	if !ok {
+		return fmt.Errorf("unable to replicate map '%s'", name)
+	}
+	return p.register(name, mm, func() {
+		mm.primary = &primaryHook{p: p, name: name}
+	})
+}
+
+// ReplicateList registers l under name, so its changes are sent to the followers of p.
+// Followers need a List registered under the same name with FollowList.
+// ReplicateList locks l by itself.
+func ReplicateList[T any](p *Primary, name string, l List[T]) error {
+	ml, ok := l.(*memoryList[T])
+	if !ok {
+		return fmt.Errorf("unable to replicate list '%s'", name)
+	}
+	return p.register(name, ml, func() {
+		ml.primary = &primaryHook{p: p, name: name}
+	})
+}
+
+// register adds s to p and attaches the hook with attach.
+// The current state of s is recorded, so connected followers pick it up.
+func (p *Primary) register(name string, s primaryStore, attach func()) error {
+	s.Lock()
+	defer s.Unlock()
+
+	p.mut.Lock()
+	if _, ok := p.stores[name]; ok {
+		p.mut.Unlock()
+		return fmt.Errorf("data store '%s' is already replicated", name)
+	}
+	p.stores[name] = s
+	p.mut.Unlock()
+
+	attach()
+	c, err := s.snapshot()
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to encode data store '%s'", name), err)
+	}
+	c.Store = name
+	p.record(c)
+	return nil
+}
+
+func (h *primaryHook) record(c replChange) {
+	c.Store = h.name
+	h.p.record(c)
+}
+
+// record appends c to the log and wakes up the connections.
+// The caller holds the write lock of the changed data store.
+func (p *Primary) record(c replChange) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.seq++
+	c.Seq = p.seq
+	p.log = append(p.log, c)
+	if len(p.log) > p.logSize {
+		p.log = p.log[len(p.log)-p.logSize:]
+	}
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// Seq returns the sequence number of the last change.
+func (p *Primary) Seq() uint64 {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return p.seq
+}
+
+// Followers returns the followers that are currently connected, ordered by address.
+func (p *Primary) Followers() []FollowerStatus {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	followers := make([]FollowerStatus, 0, len(p.followers))
+	for _, f := range p.followers {
+		followers = append(followers, *f)
+	}
+	sort.Slice(followers, func(i, j int) bool {
+		return followers[i].Addr < followers[j].Addr
+	})
+	return followers
+}
+
+// Serve accepts followers on ln until ln is closed.
+// Closing ln also disconnects all followers accepted by it.
+func (p *Primary) Serve(ln net.Listener) error {
+	var wg sync.WaitGroup
+	conns := make(map[net.Conn]struct{})
+	var connsMut sync.Mutex
+	defer func() {
+		connsMut.Lock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+		connsMut.Unlock()
+		wg.Wait()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return errors.Join(errors.New("failed to accept follower"), err)
+		}
+		connsMut.Lock()
+		conns[conn] = struct{}{}
+		connsMut.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.serveConn(conn); err != nil && !errors.Is(err, net.ErrClosed) {
+				log(errors.Join(fmt.Errorf("replication to '%s' stopped", conn.RemoteAddr()), err))
+			}
+			connsMut.Lock()
+			delete(conns, conn)
+			connsMut.Unlock()
+		}()
+	}
+}
+
+// serveConn streams the changes to one follower until the connection breaks.
+func (p *Primary) serveConn(conn net.Conn) error {
+	defer conn.Close()
+	decoder := json.NewDecoder(conn)
+	w := bufio.NewWriter(conn)
+	encoder := json.NewEncoder(w)
+
+	var hello replMessage
+	_ = conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	if err := decoder.Decode(&hello); err != nil || hello.Type != "hello" {
+		return errors.Join(errors.New("invalid handshake"), err)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	status := &FollowerStatus{Addr: conn.RemoteAddr().String(), Acked: hello.Seq}
+	p.mut.Lock()
+	p.followers[conn] = status
+	p.mut.Unlock()
+	defer func() {
+		p.mut.Lock()
+		delete(p.followers, conn)
+		p.mut.Unlock()
+	}()
+
+	// read acks until the connection breaks, which also ends the stream below
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var ack replMessage
+			if err := decoder.Decode(&ack); err != nil {
+				_ = conn.Close()
+				return
+			}
+			p.mut.Lock()
+			status.Acked = ack.Seq
+			p.mut.Unlock()
+		}
+	}()
+
+	pos := hello.Seq
+	p.mut.Lock()
+	resume := hello.Epoch == p.epoch && p.canResume(pos)
+	p.mut.Unlock()
+	if !resume {
+		snapshots, seq, err := p.snapshot()
+		if err != nil {
+			return err
+		}
+		welcome := replMessage{Type: "welcome", Epoch: p.epoch, Seq: seq, Snapshots: len(snapshots)}
+		if err := encoder.Encode(welcome); err != nil {
+			return err
+		}
+		for i := range snapshots {
+			if err := encoder.Encode(replMessage{Type: "change", Change: &snapshots[i]}); err != nil {
+				return err
+			}
+		}
+		pos = seq
+	} else if err := encoder.Encode(replMessage{Type: "welcome", Epoch: p.epoch, Seq: pos}); err != nil {
+		return err
+	}
+
+	for {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		p.mut.Lock()
+		if !p.canResume(pos) {
+			p.mut.Unlock()
+			return fmt.Errorf("follower fell behind at %d", pos)
+		}
+		var changes []replChange
+		if len(p.log) > 0 && pos < p.seq {
+			changes = p.log[len(p.log)-int(p.seq-pos):]
+		}
+		changed := p.changed
+		p.mut.Unlock()
+
+		if len(changes) == 0 {
+			select {
+			case <-changed:
+				continue
+			case <-done:
+				return nil
+			}
+		}
+		for i := range changes {
+			if err := encoder.Encode(replMessage{Type: "change", Change: &changes[i]}); err != nil {
+				return err
+			}
+		}
+		pos = changes[len(changes)-1].Seq
+	}
+}
+
+// canResume reports whether the changes after pos are still in the log.
+// The caller holds p.mut.
+func (p *Primary) canResume(pos uint64) bool {
+	if pos > p.seq {
+		return false
+	}
+	if pos == p.seq {
+		return true
+	}
+	return len(p.log) > 0 && p.log[0].Seq <= pos+1
+}
+
+// snapshot returns the state of all data stores and the sequence number it belongs to.
+// All data stores are read locked at once, so no change can slip in between.
+func (p *Primary) snapshot() ([]replChange, uint64, error) {
+	p.mut.Lock()
+	names := make([]string, 0, len(p.stores))
+	for name := range p.stores {
+		names = append(names, name)
+	}
+	stores := p.stores
+	p.mut.Unlock()
+	sort.Strings(names)
+
+	locks := newRefLocks(false)
+	for _, name := range names {
+		locks.lock(stores[name])
+	}
+	defer locks.unlock()
+
+	p.mut.Lock()
+	seq := p.seq
+	p.mut.Unlock()
+	snapshots := make([]replChange, len(names))
+	for i, name := range names {
+		c, err := stores[name].snapshot()
+		if err != nil {
+			return nil, 0, errors.Join(fmt.Errorf("failed to encode data store '%s'", name), err)
+		}
+		c.Seq = seq
+		c.Store = name
+		snapshots[i] = c
+	}
+	return snapshots, seq, nil
+}
+
+func (m *memoryMap[T]) snapshot() (replChange, error) {
+	data := make(map[string]T, m.data.len())
+	for key, value := range m.data.all() {
+		data[key] = value
+	}
+	b, err := json.Marshal(mapSnapshot[T]{Data: data, Expires: m.expires})
+	if err != nil {
+		return replChange{}, err
+	}
+	return replChange{Op: opReset, Value: b}, nil
+}
+
+// mapSnapshot is the Value of a reset change of a Map.
+type mapSnapshot[T any] struct {
+	Data    map[string]T         `json:"data"`
+	Expires map[string]time.Time `json:"expires,omitempty"`
+}
+
+func (m *memoryMap[T]) replicateSet(key string, value T) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		log(errors.Join(fmt.Errorf("failed to replicate key '%s'", key), err))
+		return
+	}
+	m.primary.record(replChange{Op: opSet, Key: key, Value: b})
+}
+
+func (m *memoryMap[T]) replicateReset(values map[string]T) {
+	b, err := json.Marshal(mapSnapshot[T]{Data: values})
+	if err != nil {
+		log(errors.Join(errors.New("failed to replicate overwrite"), err))
+		return
+	}
+	m.primary.record(replChange{Op: opReset, Value: b})
+}
+
+func (l *memoryList[T]) lockID() any {
+	if l.db != nil {
+		return l.db
+	}
+	return l
+}
+
+func (l *memoryList[T]) snapshot() (replChange, error) {
+	b, err := json.Marshal(l.data)
+	if err != nil {
+		return replChange{}, err
+	}
+	return replChange{Op: opReset, Value: b}, nil
+}
+
+func (l *memoryList[T]) replicateAppend(value T) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		log(errors.Join(errors.New("failed to replicate append"), err))
+		return
+	}
+	l.primary.record(replChange{Op: opAppend, Value: b})
+}
+
+func (l *memoryList[T]) replicateSet(index int, value T) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		log(errors.Join(fmt.Errorf("failed to replicate index %d", index), err))
+		return
+	}
+	l.primary.record(replChange{Op: opSet, Index: index, Value: b})
+}
+
+func (l *memoryList[T]) replicateReset(values []T) {
+	b, err := json.Marshal(values)
+	if err != nil {
+		log(errors.Join(errors.New("failed to replicate overwrite"), err))
+		return
+	}
+	l.primary.record(replChange{Op: opReset, Value: b})
+}
@@ -0,0 +1,294 @@
+package speicher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it is true or fails the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// servePrimary serves p on a localhost listener that is closed when the test ends.
+func servePrimary(t *testing.T, p *Primary) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := p.Serve(ln); err != nil {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+		<-done
+	})
+	return ln.Addr().String()
+}
+
+// runFollower runs f against addr until the test ends.
+func runFollower(t *testing.T, f *Follower, addr string) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = f.Run(ctx, addr)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// proxy forwards connections to addr until the test ends.
+// Calling the returned function breaks the open connections.
+func proxy(t *testing.T, addr string) (string, func()) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mut sync.Mutex
+	var conns []net.Conn
+	breakConns := func() {
+		mut.Lock()
+		defer mut.Unlock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+		conns = nil
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			u, err := net.Dial("tcp", addr)
+			if err != nil {
+				_ = c.Close()
+				continue
+			}
+			mut.Lock()
+			conns = append(conns, c, u)
+			mut.Unlock()
+			go func() {
+				_, _ = io.Copy(u, c)
+				_ = u.Close()
+			}()
+			go func() {
+				_, _ = io.Copy(c, u)
+				_ = c.Close()
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+		breakConns()
+	})
+	return ln.Addr().String(), breakConns
+}
+
+func TestReplicationRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	pm, err := LoadMap[int](filepath.Join(dir, "primary-map.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl, err := LoadList[string](filepath.Join(dir, "primary-list.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm, err := LoadMap[int](filepath.Join(dir, "follower-map.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fl, err := LoadList[string](filepath.Join(dir, "follower-list.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm.Lock()
+	_ = pm.Set("a", 1)
+	_ = pm.Set("b", 2)
+	pm.Unlock()
+	pl.Lock()
+	pl.Append("x")
+	pl.Unlock()
+
+	p := NewPrimary()
+	if err := ReplicateMap(p, "map", pm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplicateList(p, "list", pl); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFollower()
+	if err := FollowMap(f, "map", fm); err != nil {
+		t.Fatal(err)
+	}
+	if err := FollowList(f, "list", fl); err != nil {
+		t.Fatal(err)
+	}
+	runFollower(t, f, servePrimary(t, p))
+
+	// the initial state arrives as snapshots
+	waitFor(t, "snapshot", func() bool { return f.Seq() == p.Seq() })
+	fm.RLock()
+	if v, _ := fm.Get("b"); v != 2 {
+		t.Errorf("follower map has b = %d, want 2", v)
+	}
+	fm.RUnlock()
+
+	// later changes arrive as a stream
+	pm.Lock()
+	_ = pm.Set("c", 3)
+	_ = pm.Delete("a")
+	pm.Unlock()
+	pl.Lock()
+	pl.Append("y")
+	_ = pl.Set(0, "z")
+	pl.Unlock()
+	waitFor(t, "changes", func() bool { return f.Seq() == p.Seq() })
+
+	fm.RLock()
+	if fm.Has("a") {
+		t.Error("follower map still has deleted key a")
+	}
+	if v, _ := fm.Get("c"); v != 3 {
+		t.Errorf("follower map has c = %d, want 3", v)
+	}
+	fm.RUnlock()
+	fl.RLock()
+	if got := fl.Query().Collect(); len(got) != 2 || got[0] != "z" || got[1] != "y" {
+		t.Errorf("follower list is %v, want [z y]", got)
+	}
+	fl.RUnlock()
+
+	waitFor(t, "ack", func() bool {
+		followers := p.Followers()
+		return len(followers) == 1 && followers[0].Acked == p.Seq()
+	})
+
+	fm.Lock()
+	err = fm.Set("d", 4)
+	fm.Unlock()
+	if !errors.Is(err, ErrFollower) {
+		t.Errorf("Set on a follower returned %v, want ErrFollower", err)
+	}
+	fl.Lock()
+	err = fl.Append("w")
+	fl.Unlock()
+	if !errors.Is(err, ErrFollower) {
+		t.Errorf("Append on a follower returned %v, want ErrFollower", err)
+	}
+}
+
+func TestReplicationReconnect(t *testing.T) {
+	dir := t.TempDir()
+	pm, err := LoadMap[int](filepath.Join(dir, "primary-map.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm, err := LoadMap[int](filepath.Join(dir, "follower-map.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.Lock()
+	_ = pm.Set("a", 1)
+	pm.Unlock()
+
+	p := NewPrimary()
+	if err := ReplicateMap(p, "map", pm); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFollower()
+	if err := FollowMap(f, "map", fm); err != nil {
+		t.Fatal(err)
+	}
+	addr, breakConns := proxy(t, servePrimary(t, p))
+	runFollower(t, f, addr)
+	waitFor(t, "snapshot", func() bool { return f.Seq() == p.Seq() })
+
+	// a change after the snapshot gives a its own version, which a new snapshot would reset
+	pm.Lock()
+	_ = pm.Set("a", 2)
+	pm.Unlock()
+	waitFor(t, "change", func() bool { return f.Seq() == p.Seq() })
+	waitFor(t, "ack", func() bool {
+		followers := p.Followers()
+		return len(followers) == 1 && followers[0].Acked == p.Seq()
+	})
+	fm.RLock()
+	version, _ := fm.Version("a")
+	fm.RUnlock()
+
+	breakConns()
+	waitFor(t, "disconnect", func() bool { return len(p.Followers()) == 0 })
+	pm.Lock()
+	_ = pm.Set("b", 3)
+	pm.Unlock()
+
+	// the follower reconnects and continues after the last acked change
+	waitFor(t, "reconnect", func() bool { return f.Seq() == p.Seq() })
+	fm.RLock()
+	defer fm.RUnlock()
+	if v, _ := fm.Get("b"); v != 3 {
+		t.Errorf("follower map has b = %d, want 3", v)
+	}
+	if v, _ := fm.Version("a"); v != version {
+		t.Error("follower map was reset instead of resumed")
+	}
+}
+
+func TestReplicationEmptyPrimary(t *testing.T) {
+	dir := t.TempDir()
+	p := NewPrimary()
+	f := NewFollower()
+	fm, err := LoadMap[int](filepath.Join(dir, "follower-map.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := FollowMap(f, "map", fm); err != nil {
+		t.Fatal(err)
+	}
+	runFollower(t, f, servePrimary(t, p))
+	waitFor(t, "follower", func() bool { return len(p.Followers()) == 1 })
+
+	// a data store registered after the follower connected is sent as a change
+	pm, err := LoadMap[int](filepath.Join(dir, "primary-map.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.Lock()
+	_ = pm.Set("a", 1)
+	pm.Unlock()
+	if err := ReplicateMap(p, "map", pm); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "change", func() bool { return f.Seq() == p.Seq() })
+	fm.RLock()
+	defer fm.RUnlock()
+	if v, _ := fm.Get("a"); v != 1 {
+		t.Errorf("follower map has a = %d, want 1", v)
+	}
+}
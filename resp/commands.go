@@ -0,0 +1,530 @@
+package resp
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultScanCount is the number of keys SCAN looks at if COUNT is not given.
+	defaultScanCount = 10
+)
+
+// command is a supported command.
+type command struct {
+	// arity is the number of arguments including the command name.
+	// A negative arity -n means at least n arguments.
+	arity int
+	run   func(s *Server, w *writer, args []string)
+}
+
+var commands = map[string]command{
+	"get":     {2, (*Server).get},
+	"set":     {-3, (*Server).set},
+	"del":     {-2, (*Server).del},
+	"exists":  {-2, (*Server).exists},
+	"keys":    {2, (*Server).keys},
+	"scan":    {-2, (*Server).scan},
+	"incr":    {2, (*Server).incr},
+	"incrby":  {3, (*Server).incr},
+	"decr":    {2, (*Server).incr},
+	"decrby":  {3, (*Server).incr},
+	"expire":  {3, (*Server).expire},
+	"ttl":     {2, (*Server).ttl},
+	"persist": {2, (*Server).persist},
+	"lpush":   {-3, (*Server).push},
+	"rpush":   {-3, (*Server).push},
+	"lrange":  {4, (*Server).lrange},
+	"llen":    {2, (*Server).llen},
+	"ping":    {-1, (*Server).ping},
+	"echo":    {2, (*Server).echo},
+	"select":  {2, (*Server).selectDB},
+}
+
+// run runs the command in args and writes its reply.
+// It returns true if the client quits.
+func (s *Server) run(w *writer, raw [][]byte) bool {
+	args := make([]string, len(raw))
+	for i, arg := range raw {
+		args[i] = string(arg)
+	}
+	name := strings.ToLower(args[0])
+	if name == "quit" {
+		w.simple("OK")
+		return true
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		w.errorf("ERR unknown command '%s'", printable(raw[0]))
+		return false
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.errorf("ERR wrong number of arguments for '%s' command", name)
+		return false
+	}
+	cmd.run(s, w, args)
+	return false
+}
+
+func (s *Server) get(w *writer, args []string) {
+	s.m.RLock()
+	value, ok := s.m.Get(args[1])
+	s.m.RUnlock()
+	if !ok {
+		w.null()
+		return
+	}
+	w.bulk(value)
+}
+
+func (s *Server) set(w *writer, args []string) {
+	var ttl time.Duration
+	var nx, xx bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ex", "px":
+			if i+1 == len(args) || ttl != 0 {
+				w.writeErr(errSyntax)
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || n <= 0 {
+				w.errorf("ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Second
+			if opt == "px" {
+				unit = time.Millisecond
+			}
+			if n > math.MaxInt64/int64(unit) {
+				w.errorf("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl = time.Duration(n) * unit
+		default:
+			w.writeErr(errSyntax)
+			return
+		}
+	}
+	if nx && xx {
+		w.writeErr(errSyntax)
+		return
+	}
+
+	key, value := args[1], args[2]
+	s.m.Lock()
+	defer s.m.Unlock()
+	if (nx && s.m.Has(key)) || (xx && !s.m.Has(key)) {
+		w.null()
+		return
+	}
+	var err error
+	if ttl > 0 {
+		err = s.m.SetWithTTL(key, value, ttl)
+	} else {
+		err = s.m.Set(key, value)
+	}
+	if err != nil {
+		w.writeErr(err)
+		return
+	}
+	w.simple("OK")
+}
+
+func (s *Server) del(w *writer, args []string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var n int64
+	for _, key := range args[1:] {
+		if !s.m.Has(key) {
+			continue
+		}
+		if err := s.m.Delete(key); err != nil {
+			w.writeErr(err)
+			return
+		}
+		n++
+	}
+	w.integer(n)
+}
+
+// exists counts the given keys that exist. Keys given more than once are counted more than once.
+func (s *Server) exists(w *writer, args []string) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	var n int64
+	for _, key := range args[1:] {
+		if s.m.Has(key) {
+			n++
+		}
+	}
+	w.integer(n)
+}
+
+func (s *Server) keys(w *writer, args []string) {
+	s.m.RLock()
+	els := s.m.Query().CollectKV()
+	s.m.RUnlock()
+	keys := make([]string, 0, len(els))
+	for _, el := range els {
+		if match(args[1], el.Key) {
+			keys = append(keys, el.Key)
+		}
+	}
+	w.bulks(keys)
+}
+
+// scan pages through the keys in ascending order with MapQuery.Page, which is cheap for an OrderedMap.
+// The cursor holds the last key of the page, so keys added or deleted during a scan don't shift the following ones.
+func (s *Server) scan(w *writer, args []string) {
+	cursor := args[1]
+	if cursor == "0" {
+		cursor = ""
+	}
+	pattern, count := "*", defaultScanCount
+	var err error
+	for i := 2; i < len(args); i++ {
+		if i+1 == len(args) {
+			w.writeErr(errSyntax)
+			return
+		}
+		switch strings.ToLower(args[i]) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil || count < 1 {
+				w.writeErr(errSyntax)
+				return
+			}
+		default:
+			w.writeErr(errSyntax)
+			return
+		}
+		i++
+	}
+
+	s.m.RLock()
+	page, err := s.m.Query().Limit(count).Page(cursor)
+	s.m.RUnlock()
+	if err != nil {
+		w.errorf("ERR invalid cursor")
+		return
+	}
+	next := page.Next
+	if next == "" {
+		next = "0"
+	}
+	keys := make([]string, 0, len(page.Elements))
+	for _, el := range page.Elements {
+		if match(pattern, el.Key) {
+			keys = append(keys, el.Key)
+		}
+	}
+	w.arrayLen(2)
+	w.bulk(next)
+	w.bulks(keys)
+}
+
+// incr implements INCR, INCRBY, DECR and DECRBY. A missing key counts as 0.
+// The expiration time of the key is kept.
+func (s *Server) incr(w *writer, args []string) {
+	delta := int64(1)
+	if len(args) == 3 {
+		var err error
+		delta, err = strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			w.errorf("ERR value is not an integer or out of range")
+			return
+		}
+	}
+	if strings.HasPrefix(strings.ToLower(args[0]), "decr") {
+		if delta == math.MinInt64 {
+			w.errorf("ERR decrement would overflow")
+			return
+		}
+		delta = -delta
+	}
+
+	key := args[1]
+	s.m.Lock()
+	defer s.m.Unlock()
+	var n int64
+	if value, ok := s.m.Get(key); ok {
+		var err error
+		n, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			w.errorf("ERR value is not an integer or out of range")
+			return
+		}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		w.errorf("ERR increment or decrement would overflow")
+		return
+	}
+	n += delta
+	at, expires := s.m.ExpiresAt(key)
+	if err := s.m.Set(key, strconv.FormatInt(n, 10)); err != nil {
+		w.writeErr(err)
+		return
+	}
+	if expires {
+		if _, err := s.m.Expire(key, at); err != nil {
+			w.writeErr(err)
+			return
+		}
+	}
+	w.integer(n)
+}
+
+// expire sets the time to live of a key. A time that is not positive deletes the key.
+func (s *Server) expire(w *writer, args []string) {
+	seconds, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil || seconds > math.MaxInt64/int64(time.Second) {
+		w.errorf("ERR value is not an integer or out of range")
+		return
+	}
+	key := args[1]
+	s.m.Lock()
+	defer s.m.Unlock()
+	if !s.m.Has(key) {
+		w.integer(0)
+		return
+	}
+	if seconds <= 0 {
+		if err := s.m.Delete(key); err != nil {
+			w.writeErr(err)
+			return
+		}
+		w.integer(1)
+		return
+	}
+	ok, err := s.m.Expire(key, time.Now().Add(time.Duration(seconds)*time.Second))
+	if err != nil {
+		w.writeErr(err)
+		return
+	}
+	if !ok {
+		w.integer(0)
+		return
+	}
+	w.integer(1)
+}
+
+// ttl returns the seconds until a key expires, -1 if it does not expire and -2 if it does not exist.
+func (s *Server) ttl(w *writer, args []string) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if !s.m.Has(args[1]) {
+		w.integer(-2)
+		return
+	}
+	at, ok := s.m.ExpiresAt(args[1])
+	if !ok {
+		w.integer(-1)
+		return
+	}
+	w.integer(int64(math.Ceil(time.Until(at).Seconds())))
+}
+
+func (s *Server) persist(w *writer, args []string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	ok, err := s.m.Persist(args[1])
+	if err != nil {
+		w.writeErr(err)
+		return
+	}
+	if ok {
+		w.integer(1)
+		return
+	}
+	w.integer(0)
+}
+
+// push implements LPUSH and RPUSH. Only registered Lists can be pushed to.
+// LPUSH inserts the values one after another at the head, so they end up in reverse order.
+func (s *Server) push(w *writer, args []string) {
+	l, ok := s.list(args[1])
+	if !ok {
+		w.errorf("ERR no such list '%s'", args[1])
+		return
+	}
+	values := args[2:]
+	l.Lock()
+	defer l.Unlock()
+	if strings.ToLower(args[0]) == "rpush" {
+		for _, value := range values {
+			if err := l.Append(value); err != nil {
+				w.writeErr(err)
+				return
+			}
+		}
+	} else {
+		data := make([]string, 0, len(values)+l.Len())
+		for i := len(values) - 1; i >= 0; i-- {
+			data = append(data, values[i])
+		}
+		if err := l.Overwrite(append(data, l.Query().Collect()...)); err != nil {
+			w.writeErr(err)
+			return
+		}
+	}
+	w.integer(int64(l.Len()))
+}
+
+// lrange returns the elements from start to stop, both inclusive.
+// Negative indexes count from the end. A List that is not registered is empty.
+func (s *Server) lrange(w *writer, args []string) {
+	start, err1 := strconv.Atoi(args[2])
+	stop, err2 := strconv.Atoi(args[3])
+	if err1 != nil || err2 != nil {
+		w.errorf("ERR value is not an integer or out of range")
+		return
+	}
+	l, ok := s.list(args[1])
+	if !ok {
+		w.arrayLen(0)
+		return
+	}
+	l.RLock()
+	defer l.RUnlock()
+	n := l.Len()
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		w.arrayLen(0)
+		return
+	}
+	w.bulks(l.Query().Offset(start).Limit(stop - start + 1).Collect())
+}
+
+func (s *Server) llen(w *writer, args []string) {
+	l, ok := s.list(args[1])
+	if !ok {
+		w.integer(0)
+		return
+	}
+	l.RLock()
+	defer l.RUnlock()
+	w.integer(int64(l.Len()))
+}
+
+func (s *Server) ping(w *writer, args []string) {
+	switch len(args) {
+	case 1:
+		w.simple("PONG")
+	case 2:
+		w.bulk(args[1])
+	default:
+		w.errorf("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *Server) echo(w *writer, args []string) {
+	w.bulk(args[1])
+}
+
+// selectDB accepts only database 0, the only one there is.
+func (s *Server) selectDB(w *writer, args []string) {
+	if args[1] != "0" {
+		w.errorf("ERR DB index is out of range")
+		return
+	}
+	w.simple("OK")
+}
+
+// match reports whether key matches the glob-style pattern of KEYS and SCAN.
+// * matches any sequence, ? any single byte, [abc] and [a-z] a set, [^abc] its complement,
+// and \ escapes the next byte.
+func match(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if match(pattern, key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+			key = key[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				// an unterminated set is matched literally
+				if key[0] != '[' {
+					return false
+				}
+				key, pattern = key[1:], pattern[1:]
+				continue
+			}
+			set := pattern[1 : end+1]
+			negate := strings.HasPrefix(set, "^")
+			if negate {
+				set = set[1:]
+			}
+			if inSet(set, key[0]) == negate {
+				return false
+			}
+			key, pattern = key[1:], pattern[end+2:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+			key, pattern = key[1:], pattern[1:]
+		}
+	}
+	return len(key) == 0
+}
+
+// inSet reports whether c is in a set of a pattern, like "abc" or "a-z".
+func inSet(set string, c byte) bool {
+	for i := 0; i < len(set); i++ {
+		if i+2 < len(set) && set[i+1] == '-' {
+			lo, hi := set[i], set[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				return true
+			}
+			i += 2
+			continue
+		}
+		if set[i] == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxArgs is the largest number of arguments a command can have.
+	maxArgs = 16 << 10
+	// maxBulkLen is the largest argument that is accepted.
+	maxBulkLen = 8 << 20
+	// maxInlineLen is the longest inline command that is accepted.
+	maxInlineLen = 64 << 10
+)
+
+type (
+	// protocolError is a malformed request. It is reported to the client before the connection is closed.
+	protocolError string
+
+	// writer writes RESP2 replies.
+	writer struct {
+		w *bufio.Writer
+	}
+)
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+// readLine reads a line terminated by CRLF, or by LF for inline commands, without the terminator.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxInlineLen {
+			return nil, protocolError("too big inline request")
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+// readCommand reads the next command, either as an array of bulk strings or as an inline command.
+// An empty inline command returns no arguments.
+// Buffers grow with the bytes that arrive instead of the sizes the client declares.
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return inlineArgs(line)
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+	var args [][]byte
+	for range n {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError(fmt.Sprintf("expected '$', got '%s'", printable(line)))
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, protocolError("invalid bulk length")
+		}
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r, int64(size)+2); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		arg := buf.Bytes()
+		if !bytes.HasSuffix(arg, []byte("\r\n")) {
+			return nil, protocolError("bulk string not terminated by CRLF")
+		}
+		args = append(args, arg[:size])
+	}
+	return args, nil
+}
+
+// inlineArgs splits an inline command at whitespace. Arguments can be quoted with " or '.
+func inlineArgs(line []byte) ([][]byte, error) {
+	var args [][]byte
+	var arg []byte
+	inArg := false
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == '"' && c == '\\' && i+1 < len(line):
+			i++
+			arg = append(arg, line[i])
+		case quote != 0:
+			arg = append(arg, c)
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\r':
+			if inArg {
+				args = append(args, arg)
+				arg, inArg = nil, false
+			}
+		default:
+			arg = append(arg, c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, protocolError("unbalanced quotes in request")
+	}
+	if inArg {
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// printable shortens line for an error message.
+func printable(line []byte) string {
+	if len(line) > 32 {
+		line = line[:32]
+	}
+	return strings.ToValidUTF8(string(line), "?")
+}
+
+func (w *writer) simple(s string) {
+	w.w.WriteString("+" + s + "\r\n")
+}
+
+// error writes an error reply. msg starts with the error code, like "ERR" or "WRONGTYPE".
+func (w *writer) error(msg string) {
+	w.w.WriteString("-" + strings.ReplaceAll(msg, "\r\n", " ") + "\r\n")
+}
+
+func (w *writer) errorf(format string, a ...any) {
+	w.error(fmt.Sprintf(format, a...))
+}
+
+func (w *writer) integer(n int64) {
+	w.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *writer) bulk(s string) {
+	w.w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+// null writes the null bulk string, the reply for a missing value.
+func (w *writer) null() {
+	w.w.WriteString("$-1\r\n")
+}
+
+// arrayLen writes the header of an array with n elements, which have to be written next.
+func (w *writer) arrayLen(n int) {
+	w.w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+func (w *writer) bulks(values []string) {
+	w.arrayLen(len(values))
+	for _, v := range values {
+		w.bulk(v)
+	}
+}
+
+// writeErr reports err as an error reply.
+func (w *writer) writeErr(err error) {
+	var msg string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if msg != "" {
+			msg += ": "
+		}
+		msg += line
+	}
+	w.error("ERR " + msg)
+}
+
+// errSyntax is the reply for options that are not understood.
+var errSyntax = errors.New("syntax error")
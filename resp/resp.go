@@ -0,0 +1,138 @@
+// Package resp serves speicher data stores to Redis clients over a subset of RESP2, the Redis protocol.
+//
+// The keyspace is a Map[string]. Lists are registered by name with HandleList and live next to it,
+// so they are not part of KEYS, SCAN, DEL or EXISTS. Supported commands:
+//
+//	GET key
+//	SET key value [EX seconds | PX milliseconds] [NX | XX]
+//	DEL key [key ...]
+//	EXISTS key [key ...]
+//	KEYS pattern
+//	SCAN cursor [MATCH pattern] [COUNT count]
+//	INCR key, INCRBY key increment, DECR key, DECRBY key decrement
+//	EXPIRE key seconds, TTL key, PERSIST key
+//	LPUSH key value [value ...], RPUSH key value [value ...]
+//	LRANGE key start stop, LLEN key
+//	PING [message], ECHO message, SELECT 0, QUIT
+//
+// Every command locks the data store it uses for its duration, so changes are saved like any other change.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/tsukinoko-kun/speicher"
+)
+
+// Server serves a Map and a set of named Lists to Redis clients.
+// It is safe to register Lists while serving.
+type Server struct {
+	m     speicher.Map[string]
+	mut   sync.RWMutex
+	lists map[string]speicher.List[string]
+}
+
+// New creates a Server whose keyspace is m.
+// With an OrderedMap, SCAN only walks the keys of each page.
+func New(m speicher.Map[string]) *Server {
+	return &Server{
+		m:     m,
+		lists: make(map[string]speicher.List[string]),
+	}
+}
+
+// HandleList serves l as the list with the given key.
+// Registering the same key again replaces the List.
+func (s *Server) HandleList(key string, l speicher.List[string]) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.lists[key] = l
+}
+
+// list returns the List registered under key.
+func (s *Server) list(key string) (speicher.List[string], bool) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	l, ok := s.lists[key]
+	return l, ok
+}
+
+// Serve accepts clients on ln until ln is closed.
+// Closing ln also disconnects all clients accepted by it.
+func (s *Server) Serve(ln net.Listener) error {
+	var wg sync.WaitGroup
+	conns := make(map[net.Conn]struct{})
+	var connsMut sync.Mutex
+	defer func() {
+		connsMut.Lock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+		connsMut.Unlock()
+		wg.Wait()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return errors.Join(errors.New("failed to accept client"), err)
+		}
+		connsMut.Lock()
+		conns[conn] = struct{}{}
+		connsMut.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(conn)
+			connsMut.Lock()
+			delete(conns, conn)
+			connsMut.Unlock()
+		}()
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves clients until listening fails.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// serveConn runs the commands of one client until it quits or the connection breaks.
+// Replies are flushed once no more pipelined commands are buffered.
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := &writer{w: bufio.NewWriter(conn)}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			var perr protocolError
+			if errors.As(err, &perr) {
+				w.error("ERR Protocol error: " + perr.Error())
+				_ = w.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.run(w, args)
+		if r.Buffered() == 0 || quit {
+			if err := w.w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
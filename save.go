@@ -1,7 +1,10 @@
 package speicher
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
@@ -16,6 +19,51 @@ type savable interface {
 	setSaveOnce(*sync.Once)
 }
 
+// saveState holds the timers used to debounce saving a data store.
+// Embed it in a data store to implement the timer part of savable.
+type saveState struct {
+	timerMut     sync.Mutex
+	saveTimer    *time.Timer
+	maxSaveTimer *time.Timer
+	saveOnce     *sync.Once
+}
+
+func (s *saveState) getSaveTimer() *time.Timer {
+	s.timerMut.Lock()
+	defer s.timerMut.Unlock()
+	return s.saveTimer
+}
+
+func (s *saveState) setSaveTimer(t *time.Timer) {
+	s.timerMut.Lock()
+	defer s.timerMut.Unlock()
+	s.saveTimer = t
+}
+
+func (s *saveState) getMaxSaveTimer() *time.Timer {
+	s.timerMut.Lock()
+	defer s.timerMut.Unlock()
+	return s.maxSaveTimer
+}
+
+func (s *saveState) setMaxSaveTimer(t *time.Timer) {
+	s.timerMut.Lock()
+	defer s.timerMut.Unlock()
+	s.maxSaveTimer = t
+}
+
+func (s *saveState) getSaveOnce() *sync.Once {
+	s.timerMut.Lock()
+	defer s.timerMut.Unlock()
+	return s.saveOnce
+}
+
+func (s *saveState) setSaveOnce(o *sync.Once) {
+	s.timerMut.Lock()
+	defer s.timerMut.Unlock()
+	s.saveOnce = o
+}
+
 var errChan chan error = nil
 
 // Err returns the error channel used when saving the data stores to disk.
@@ -82,3 +130,57 @@ func notifyChanged(s savable) {
 		s.setMaxSaveTimer(newMaxTimer)
 	}
 }
+
+// saveJsonFile writes v as json to the file at location.
+func saveJsonFile(location string, v any) error {
+	return saveFile(location, jsonCodec{}, v)
+}
+
+// saveFile writes v encoded with c to the file at location.
+// The data is written to a temporary file first, which then replaces the file at location,
+// so the file is never left half written.
+func saveFile(location string, c Codec, v any) error {
+	f, err := os.CreateTemp(filepath.Dir(location), filepath.Base(location)+".*.tmp")
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to open file '%s'", location), err)
+	}
+	defer os.Remove(f.Name())
+	if err := c.Encode(f, v); err != nil {
+		_ = f.Close()
+		return errors.Join(fmt.Errorf("failed to encode file '%s'", location), err)
+	}
+	if err := f.Chmod(0640); err != nil {
+		_ = f.Close()
+		return errors.Join(fmt.Errorf("failed to write file '%s'", location), err)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Join(fmt.Errorf("failed to write file '%s'", location), err)
+	}
+	if err := os.Rename(f.Name(), location); err != nil {
+		return errors.Join(fmt.Errorf("failed to replace file '%s'", location), err)
+	}
+	return nil
+}
+
+// loadJsonFile decodes the json file at location into v.
+// If the file does not exist, v is left untouched, the directory of the file is created
+// and the bool result will be false.
+func loadJsonFile(location string, v any) (bool, error) {
+	return loadFile(location, jsonCodec{}, v)
+}
+
+// loadFile is like loadJsonFile but decodes the file with c.
+func loadFile(location string, c Codec, v any) (bool, error) {
+	f, err := os.Open(location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, os.MkdirAll(filepath.Dir(location), 0740)
+		}
+		return false, errors.Join(fmt.Errorf("failed to open file '%s'", location), err)
+	}
+	defer f.Close()
+	if err := c.Decode(f, v); err != nil {
+		return false, errors.Join(fmt.Errorf("failed to decode file '%s'", location), err)
+	}
+	return true, nil
+}
@@ -0,0 +1,244 @@
+package speicher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+type (
+	// memorySet is a Set implementation that keeps all elements in memory.
+	memorySet[T comparable] struct {
+		data     map[T]struct{}
+		location string
+		mut      sync.RWMutex
+
+		saveState
+	}
+
+	// Set is a thread-safe data store interface for a collection of unique elements.
+	// It provides constant time insertion, removal and membership tests.
+	Set[T comparable] interface {
+		// Add inserts the provided value into the Set.
+		// It returns true if the value was added, and false if it was already present.
+		Add(value T) bool
+
+		// Remove deletes the provided value from the Set.
+		// It returns true if the value was removed, and false if it was not present.
+		Remove(value T) bool
+
+		// Contains checks if the provided value is in the Set.
+		Contains(value T) bool
+
+		// Find traverses the Set and returns the first element that satisfies the provided predicate function.
+		// If no element is found, the bool result will be false.
+		Find(func(T) bool) (value T, found bool)
+
+		// FindAll returns all elements in the Set that satisfy the provided predicate function.
+		// If no elements match, it returns an empty slice.
+		FindAll(func(T) bool) (values []T)
+
+		// Overwrite replaces the entire Set with the values provided in the slice.
+		// Duplicate values are only stored once.
+		Overwrite([]T)
+
+		// Len returns the number of elements currently in the Set.
+		Len() int
+
+		// Values returns all elements of the Set in no particular order.
+		Values() []T
+
+		// Range returns a read-only channel through which the elements of the Set can be iterated.
+		// It also returns a cancel function to stop the iteration process if needed.
+		Range() (<-chan T, func())
+
+		// Save persists the current state of the Set to its underlying data store.
+		// The elements are written as a sorted array, so the file does not change if the Set did not.
+		// It returns an error if the operation fails.
+		Save() error
+
+		// Lock acquires an exclusive lock on the Set to ensure thread-safe operations.
+		// Don't forget to use Unlock when you are done.
+		Lock()
+
+		// Unlock releases the exclusive lock previously acquired with Lock.
+		Unlock()
+
+		// RLock acquires a read lock on the Set to allow concurrent read operations.
+		// Don't forget to use RUnlock when you are done.
+		RLock()
+
+		// RUnlock releases the read lock acquired with RLock.
+		RUnlock()
+	}
+)
+
+func (s *memorySet[T]) Add(value T) bool {
+	if _, ok := s.data[value]; ok {
+		return false
+	}
+	s.data[value] = struct{}{}
+	return true
+}
+
+func (s *memorySet[T]) Remove(value T) bool {
+	if _, ok := s.data[value]; !ok {
+		return false
+	}
+	delete(s.data, value)
+	return true
+}
+
+func (s *memorySet[T]) Contains(value T) bool {
+	_, ok := s.data[value]
+	return ok
+}
+
+func (s *memorySet[T]) Find(f func(T) bool) (value T, found bool) {
+	for value = range s.data {
+		if f(value) {
+			found = true
+			return
+		}
+	}
+	found = false
+	return
+}
+
+func (s *memorySet[T]) FindAll(f func(T) bool) (values []T) {
+	for value := range s.data {
+		if f(value) {
+			values = append(values, value)
+		}
+	}
+	return
+}
+
+func (s *memorySet[T]) Overwrite(values []T) {
+	s.data = make(map[T]struct{}, len(values))
+	for _, value := range values {
+		s.data[value] = struct{}{}
+	}
+}
+
+func (s *memorySet[T]) Len() int {
+	return len(s.data)
+}
+
+func (s *memorySet[T]) Values() []T {
+	values := make([]T, 0, len(s.data))
+	for value := range s.data {
+		values = append(values, value)
+	}
+	return values
+}
+
+func (s *memorySet[T]) Range() (<-chan T, func()) {
+	return emit(func(yield func(T) bool) {
+		for value := range s.data {
+			if !yield(value) {
+				return
+			}
+		}
+	})
+}
+
+func (s *memorySet[T]) Lock() {
+	s.mut.Lock()
+}
+
+func (s *memorySet[T]) Unlock() {
+	s.mut.Unlock()
+	notifyChanged(s)
+}
+
+func (s *memorySet[T]) RLock() {
+	s.mut.RLock()
+}
+
+func (s *memorySet[T]) RUnlock() {
+	s.mut.RUnlock()
+}
+
+func (s *memorySet[T]) Save() error {
+	s.RLock()
+	defer s.RUnlock()
+
+	// the elements are sorted by their JSON encoding, so the file does not change with the map order
+	type sortable struct {
+		key   []byte
+		value T
+	}
+	els := make([]sortable, 0, len(s.data))
+	for value := range s.data {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to encode file '%s'", s.location), err)
+		}
+		els = append(els, sortable{key: b, value: value})
+	}
+	slices.SortFunc(els, func(a, b sortable) int {
+		return bytes.Compare(a.key, b.key)
+	})
+	values := make([]T, len(els))
+	for i, el := range els {
+		values[i] = el.value
+	}
+	return saveFile(s.location, codecOf(s.location), values)
+}
+
+func LoadSet[T comparable](location string) (Set[T], error) {
+	if c, ok := codecFor(location); ok {
+		if s, err := loadSetFromFile[T](location, c); err != nil {
+			return nil, errors.Join(fmt.Errorf("unable to load set from file '%s'", location), err)
+		} else {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to find loader for '%s'", location)
+}
+
+func loadSetFromFile[T comparable](location string, c Codec) (Set[T], error) {
+	s := &memorySet[T]{
+		location: location,
+		data:     make(map[T]struct{}),
+	}
+	var values []T
+	if _, err := loadFile(location, c, &values); err != nil {
+		return nil, err
+	}
+	s.Overwrite(values)
+	return s, nil
+}
+
+// Union returns the elements that are in a, in b or in both.
+// Hold at least the read lock of both sets while calling it.
+func Union[T comparable](a, b Set[T]) []T {
+	values := a.Values()
+	for _, value := range b.Values() {
+		if !a.Contains(value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Intersection returns the elements that are in both a and b.
+// Hold at least the read lock of both sets while calling it.
+func Intersection[T comparable](a, b Set[T]) []T {
+	if a.Len() > b.Len() {
+		a, b = b, a
+	}
+	return a.FindAll(b.Contains)
+}
+
+// Difference returns the elements that are in a but not in b.
+// Hold at least the read lock of both sets while calling it.
+func Difference[T comparable](a, b Set[T]) []T {
+	return a.FindAll(func(value T) bool {
+		return !b.Contains(value)
+	})
+}
@@ -0,0 +1,116 @@
+package speicher
+
+import (
+	"math/rand/v2"
+)
+
+const skipListMaxLevel = 32
+
+type (
+	// skipList keeps a set of keys in ascending order.
+	skipList struct {
+		head   *skipNode
+		tail   *skipNode
+		level  int
+		length int
+	}
+
+	skipNode struct {
+		key  string
+		next []*skipNode
+		prev *skipNode
+	}
+)
+
+func newSkipList() *skipList {
+	return &skipList{
+		head:  &skipNode{next: make([]*skipNode, skipListMaxLevel)},
+		level: 1,
+	}
+}
+
+func randomSkipLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.IntN(4) == 0 {
+		level++
+	}
+	return level
+}
+
+// path returns, for every level, the last node whose key is smaller than key.
+func (s *skipList) path(key string) [skipListMaxLevel]*skipNode {
+	var update [skipListMaxLevel]*skipNode
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	return update
+}
+
+// insert adds key to the list. It is a no-op if the key is already present.
+func (s *skipList) insert(key string) {
+	update := s.path(key)
+	if n := update[0].next[0]; n != nil && n.key == key {
+		return
+	}
+	level := randomSkipLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update[i] = s.head
+		}
+		s.level = level
+	}
+	n := &skipNode{key: key, next: make([]*skipNode, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	if update[0] != s.head {
+		n.prev = update[0]
+	}
+	if n.next[0] != nil {
+		n.next[0].prev = n
+	} else {
+		s.tail = n
+	}
+	s.length++
+}
+
+// remove deletes key from the list. It is a no-op if the key is not present.
+func (s *skipList) remove(key string) {
+	update := s.path(key)
+	n := update[0].next[0]
+	if n == nil || n.key != key {
+		return
+	}
+	for i := 0; i < len(n.next); i++ {
+		if update[i].next[i] == n {
+			update[i].next[i] = n.next[i]
+		}
+	}
+	if n.next[0] != nil {
+		n.next[0].prev = n.prev
+	} else {
+		s.tail = n.prev
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.length--
+}
+
+// seek returns the first node with a key greater than or equal to key.
+func (s *skipList) seek(key string) *skipNode {
+	return s.path(key)[0].next[0]
+}
+
+func (s *skipList) first() *skipNode {
+	return s.head.next[0]
+}
+
+func (s *skipList) last() *skipNode {
+	return s.tail
+}
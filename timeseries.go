@@ -0,0 +1,358 @@
+package speicher
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// segmentTimeLayout is used for the file names of TimeSeries segments.
+const segmentTimeLayout = "2006-01-02T15-04-05Z"
+
+type (
+	// memoryTimeSeries is a TimeSeries implementation that keeps the points in memory
+	// and writes them to one JSON Lines file per segment.
+	memoryTimeSeries[T any] struct {
+		segments []*tsSegment[T]
+		// dropped holds the starts of the segments that were dropped for the retention
+		// and whose files are deleted by the next save.
+		dropped         []time.Time
+		location        string
+		segmentDuration time.Duration
+		retention       time.Duration
+		mut             sync.RWMutex
+
+		saveState
+	}
+
+	// tsSegment holds the points of one segment file, sorted by time.
+	tsSegment[T any] struct {
+		start  time.Time
+		points []Point[T]
+		// pending holds the points that were not written to the file yet.
+		pending []Point[T]
+	}
+
+	// Point is a value at a point in time stored in a TimeSeries.
+	Point[T any] struct {
+		Time  time.Time `json:"t"`
+		Value T         `json:"v"`
+	}
+
+	// TimeSeries is a thread-safe data store interface for timestamped values, like metrics.
+	// The points are partitioned by time into segment files (see WithSegmentDuration) in the directory of the TimeSeries.
+	// Saving only appends new points to their segment file instead of rewriting all data.
+	// Segments older than the retention (see WithRetention) are dropped when appending and saving.
+	TimeSeries[T any] interface {
+		// Append adds a point with the given time and value.
+		// A point that belongs to a segment older than the retention is left out.
+		Append(t time.Time, value T)
+
+		// Range returns the points with from <= time < to in ascending time order.
+		Range(from, to time.Time) []Point[T]
+
+		// Downsample splits the time between from and to into intervals of length step
+		// and combines the values of the points in every interval with agg.
+		// The returned points have the start of their interval as time.
+		// Intervals without points are left out. If step is not positive, it returns nil.
+		Downsample(from, to time.Time, step time.Duration, agg func([]T) T) []Point[T]
+
+		// Len returns the number of points in the TimeSeries.
+		Len() int
+
+		// Save persists the new points and drops segments that are older than the retention.
+		// It returns an error if the operation fails.
+		Save() error
+
+		// Lock acquires an exclusive lock on the TimeSeries to ensure thread-safe operations.
+		// Don't forget to use Unlock when you are done.
+		Lock()
+
+		// Unlock releases the exclusive lock previously acquired with Lock.
+		Unlock()
+
+		// RLock acquires a read lock on the TimeSeries to allow concurrent read operations.
+		// Don't forget to use RUnlock when you are done.
+		RLock()
+
+		// RUnlock releases the read lock acquired with RLock.
+		RUnlock()
+	}
+)
+
+// insertPoint adds p to points, keeping them sorted by time.
+func insertPoint[T any](points []Point[T], p Point[T]) []Point[T] {
+	i := sort.Search(len(points), func(i int) bool {
+		return points[i].Time.After(p.Time)
+	})
+	points = append(points, Point[T]{})
+	copy(points[i+1:], points[i:])
+	points[i] = p
+	return points
+}
+
+func (ts *memoryTimeSeries[T]) segmentFile(start time.Time) string {
+	return filepath.Join(ts.location, start.UTC().Format(segmentTimeLayout)+".jsonl")
+}
+
+// segment returns the segment that contains t, creating it if necessary.
+func (ts *memoryTimeSeries[T]) segment(t time.Time) *tsSegment[T] {
+	start := t.Truncate(ts.segmentDuration)
+	i := sort.Search(len(ts.segments), func(i int) bool {
+		return !ts.segments[i].start.Before(start)
+	})
+	if i < len(ts.segments) && ts.segments[i].start.Equal(start) {
+		return ts.segments[i]
+	}
+	s := &tsSegment[T]{start: start}
+	ts.segments = append(ts.segments, nil)
+	copy(ts.segments[i+1:], ts.segments[i:])
+	ts.segments[i] = s
+	return s
+}
+
+// expired reports whether the segment that starts at start is older than the retention at now.
+func (ts *memoryTimeSeries[T]) expired(start time.Time, now time.Time) bool {
+	return ts.retention > 0 && !start.Add(ts.segmentDuration).After(now.Add(-ts.retention))
+}
+
+// dropExpired removes the segments that are older than the retention.
+// Their files are deleted by the next save.
+func (ts *memoryTimeSeries[T]) dropExpired(now time.Time) {
+	n := sort.Search(len(ts.segments), func(i int) bool {
+		return !ts.expired(ts.segments[i].start, now)
+	})
+	for _, s := range ts.segments[:n] {
+		ts.dropped = append(ts.dropped, s.start)
+	}
+	ts.segments = slices.Delete(ts.segments, 0, n)
+}
+
+func (ts *memoryTimeSeries[T]) Append(t time.Time, value T) {
+	now := time.Now()
+	ts.dropExpired(now)
+	if ts.expired(t.Truncate(ts.segmentDuration), now) {
+		return
+	}
+	p := Point[T]{Time: t, Value: value}
+	s := ts.segment(t)
+	s.points = insertPoint(s.points, p)
+	s.pending = append(s.pending, p)
+}
+
+func (ts *memoryTimeSeries[T]) Range(from, to time.Time) []Point[T] {
+	var points []Point[T]
+	for _, s := range ts.segments {
+		if !s.start.Before(to) || !s.start.Add(ts.segmentDuration).After(from) {
+			continue
+		}
+		lo := sort.Search(len(s.points), func(i int) bool {
+			return !s.points[i].Time.Before(from)
+		})
+		hi := sort.Search(len(s.points), func(i int) bool {
+			return !s.points[i].Time.Before(to)
+		})
+		points = append(points, s.points[lo:hi]...)
+	}
+	return points
+}
+
+func (ts *memoryTimeSeries[T]) Downsample(from, to time.Time, step time.Duration, agg func([]T) T) []Point[T] {
+	if step <= 0 {
+		return nil
+	}
+	var result []Point[T]
+	var values []T
+	bucket := from
+	flush := func() {
+		if len(values) > 0 {
+			result = append(result, Point[T]{Time: bucket, Value: agg(values)})
+			values = nil
+		}
+	}
+	for _, p := range ts.Range(from, to) {
+		if next := interval(bucket, p.Time, step); !next.Equal(bucket) {
+			flush()
+			bucket = next
+		}
+		values = append(values, p.Value)
+	}
+	flush()
+	return result
+}
+
+// interval returns the start of the interval of length step that contains t,
+// counting the intervals from start, which must not be after t.
+func interval(start, t time.Time, step time.Duration) time.Time {
+	// t.Sub saturates for times that are centuries apart, so this may take more than one jump
+	for {
+		d := t.Sub(start)
+		if d < step {
+			return start
+		}
+		start = start.Add(d / step * step)
+	}
+}
+
+func (ts *memoryTimeSeries[T]) Len() int {
+	n := 0
+	for _, s := range ts.segments {
+		n += len(s.points)
+	}
+	return n
+}
+
+func (ts *memoryTimeSeries[T]) Lock() {
+	ts.mut.Lock()
+}
+
+func (ts *memoryTimeSeries[T]) Unlock() {
+	ts.mut.Unlock()
+	notifyChanged(ts)
+}
+
+func (ts *memoryTimeSeries[T]) RLock() {
+	ts.mut.RLock()
+}
+
+func (ts *memoryTimeSeries[T]) RUnlock() {
+	ts.mut.RUnlock()
+}
+
+func (ts *memoryTimeSeries[T]) Save() error {
+	// writing clears the pending points, so this needs the write lock
+	ts.mut.Lock()
+	defer ts.mut.Unlock()
+
+	var errs []error
+	ts.dropExpired(time.Now())
+	// segment files that can't be removed are tried again by the next save
+	kept := ts.dropped[:0]
+	for _, start := range ts.dropped {
+		if err := os.Remove(ts.segmentFile(start)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, errors.Join(fmt.Errorf("failed to remove segment file '%s'", ts.segmentFile(start)), err))
+			kept = append(kept, start)
+		}
+	}
+	ts.dropped = kept
+	for _, s := range ts.segments {
+		if len(s.pending) == 0 {
+			continue
+		}
+		if err := appendJsonLines(ts.segmentFile(s.start), s.pending); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s.pending = nil
+	}
+	return errors.Join(errs...)
+}
+
+func appendJsonLines[T any](location string, values []T) error {
+	f, err := os.OpenFile(location, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to open file '%s'", location), err)
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	for _, v := range values {
+		if err := encoder.Encode(v); err != nil {
+			return errors.Join(fmt.Errorf("failed to encode json file '%s'", location), err)
+		}
+	}
+	return nil
+}
+
+// LoadTimeSeries loads the TimeSeries stored in the directory at location.
+// Use WithSegmentDuration and WithRetention to configure the segments.
+// The segment duration must not change between runs.
+func LoadTimeSeries[T any](location string, opts ...Option) (TimeSeries[T], error) {
+	o := newOptions(opts)
+	if ts, err := loadTimeSeriesFromDir[T](location, o); err != nil {
+		return nil, errors.Join(fmt.Errorf("unable to load time series from directory '%s'", location), err)
+	} else {
+		return ts, nil
+	}
+}
+
+func loadTimeSeriesFromDir[T any](location string, o *options) (TimeSeries[T], error) {
+	if o.segmentDuration <= 0 {
+		return nil, fmt.Errorf("invalid segment duration %s", o.segmentDuration)
+	}
+	ts := &memoryTimeSeries[T]{
+		location:        location,
+		segmentDuration: o.segmentDuration,
+		retention:       o.retention,
+	}
+	if err := os.MkdirAll(location, 0740); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create directory '%s'", location), err)
+	}
+	entries, err := os.ReadDir(location)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read directory '%s'", location), err)
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".jsonl")
+		if !ok || e.IsDir() {
+			continue
+		}
+		start, err := time.Parse(segmentTimeLayout, name)
+		if err != nil {
+			continue
+		}
+		points, err := loadJsonLines[Point[T]](filepath.Join(location, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].Time.Before(points[j].Time)
+		})
+		ts.segments = append(ts.segments, &tsSegment[T]{start: start, points: points})
+	}
+	sort.Slice(ts.segments, func(i, j int) bool {
+		return ts.segments[i].start.Before(ts.segments[j].start)
+	})
+	return ts, nil
+}
+
+// loadJsonLines decodes the JSON Lines file at location.
+// A partial last line, left behind by a crash while appending, is cut off.
+func loadJsonLines[T any](location string) ([]T, error) {
+	f, err := os.Open(location)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to open file '%s'", location), err)
+	}
+	defer f.Close()
+	var values []T
+	var size int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				if err := os.Truncate(location, size); err != nil {
+					return nil, errors.Join(fmt.Errorf("failed to repair file '%s'", location), err)
+				}
+			}
+			return values, nil
+		}
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to read file '%s'", location), err)
+		}
+		var v T
+		if err := json.Unmarshal(line, &v); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to decode json file '%s' at offset %d", location, size), err)
+		}
+		values = append(values, v)
+		size += int64(len(line))
+	}
+}
@@ -0,0 +1,547 @@
+package speicher
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"slices"
+)
+
+// Format is a file format for ExportMap, ExportList, ImportMap and ImportList.
+type Format int
+
+const (
+	// FormatJSON is a JSON object of keys and values for a Map and a JSON array for a List.
+	FormatJSON Format = iota
+	// FormatJSONLines is one JSON value per line. Map elements are written as {"key":...,"value":...}.
+	FormatJSONLines
+	// FormatCSV is a CSV file with a header row. The fields of struct elements are flattened into columns,
+	// see csvColumns. Map elements have an additional first column "key".
+	FormatCSV
+)
+
+// ImportMode decides what ImportMap and ImportList do with the elements already in a data store.
+type ImportMode int
+
+const (
+	// ImportMerge adds the imported elements. Map elements with an existing key are overwritten.
+	ImportMerge ImportMode = iota
+	// ImportReplace replaces all elements with the imported ones.
+	ImportReplace
+	// ImportSkipExisting adds only the imported elements that are not in the data store yet.
+	// For a Map these are the elements with a new key, for a List the elements not equal to an existing one.
+	ImportSkipExisting
+)
+
+type (
+	// jsonLinesEl is a Map element in the JSON Lines format.
+	jsonLinesEl[T any] struct {
+		Key   *string `json:"key"`
+		Value T       `json:"value"`
+	}
+
+	// mapImporter applies imported Map elements in the way of an ImportMode.
+	mapImporter[T any] struct {
+		m    Map[T]
+		mode ImportMode
+		// replace collects the elements for ImportReplace, which are applied at once by done.
+		replace map[string]T
+		n       int
+	}
+
+	// listImporter applies imported List elements in the way of an ImportMode.
+	listImporter[T any] struct {
+		l       List[T]
+		mode    ImportMode
+		replace []T
+		// existing holds the JSON encodings of the elements for ImportSkipExisting.
+		existing map[string]struct{}
+		n        int
+	}
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatJSONLines:
+		return "jsonl"
+	case FormatCSV:
+		return "csv"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// mapElements iterates over the elements of m in ascending key order.
+// The values of a disk-backed Map are read one at a time, so they are not loaded into memory at once.
+// The caller holds the read lock of m.
+func mapElements[T any](m Map[T]) iter.Seq2[string, T] {
+	return func(yield func(string, T) bool) {
+		mm, ok := asMemoryMap(m)
+		if !ok {
+			for _, el := range m.Query().CollectKV() {
+				if !yield(el.Key, el.Value) {
+					return
+				}
+			}
+			return
+		}
+		var keys []string
+		for key := range mm.data.keys() {
+			if mm.live(key) {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			value, ok := mm.data.get(key)
+			if !ok {
+				continue
+			}
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// ExportMap writes all elements of m to w in the given format, ordered by key.
+// Expiration times are not exported.
+// ExportMap locks m by itself, so don't call it while holding the write lock.
+func ExportMap[T any](m Map[T], w io.Writer, format Format) error {
+	m.RLock()
+	defer m.RUnlock()
+	bw := bufio.NewWriter(w)
+	var err error
+	switch format {
+	case FormatJSON:
+		err = exportJSON(bw, '{', '}', func(yield func([]byte, error) bool) {
+			for key, value := range mapElements(m) {
+				k, _ := json.Marshal(key)
+				v, err := json.Marshal(value)
+				if err != nil {
+					err = errors.Join(fmt.Errorf("failed to encode value of key '%s'", key), err)
+				}
+				if !yield(append(append(k, ':'), v...), err) {
+					return
+				}
+			}
+		})
+	case FormatJSONLines:
+		enc := json.NewEncoder(bw)
+		for key, value := range mapElements(m) {
+			if err = enc.Encode(jsonLinesEl[T]{Key: &key, Value: value}); err != nil {
+				err = errors.Join(fmt.Errorf("failed to encode value of key '%s'", key), err)
+				break
+			}
+		}
+	case FormatCSV:
+		err = exportCSV(bw, true, func(yield func(string, T) bool) {
+			mapElements(m)(yield)
+		})
+	default:
+		return fmt.Errorf("unsupported format '%s'", format)
+	}
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to export map as %s", format), err)
+	}
+	return bw.Flush()
+}
+
+// ExportList writes all elements of l to w in the given format.
+// ExportList locks l by itself, so don't call it while holding the write lock.
+func ExportList[T any](l List[T], w io.Writer, format Format) error {
+	l.RLock()
+	defer l.RUnlock()
+	elements := func(yield func(int, T) bool) {
+		for i := range l.Len() {
+			value, _ := l.Get(i)
+			if !yield(i, value) {
+				return
+			}
+		}
+	}
+	bw := bufio.NewWriter(w)
+	var err error
+	switch format {
+	case FormatJSON:
+		err = exportJSON(bw, '[', ']', func(yield func([]byte, error) bool) {
+			for i, value := range elements {
+				v, err := json.Marshal(value)
+				if err != nil {
+					err = errors.Join(fmt.Errorf("failed to encode element %d", i), err)
+				}
+				if !yield(v, err) {
+					return
+				}
+			}
+		})
+	case FormatJSONLines:
+		enc := json.NewEncoder(bw)
+		for i, value := range elements {
+			if err = enc.Encode(value); err != nil {
+				err = errors.Join(fmt.Errorf("failed to encode element %d", i), err)
+				break
+			}
+		}
+	case FormatCSV:
+		err = exportCSV(bw, false, func(yield func(string, T) bool) {
+			for _, value := range elements {
+				if !yield("", value) {
+					return
+				}
+			}
+		})
+	default:
+		return fmt.Errorf("unsupported format '%s'", format)
+	}
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to export list as %s", format), err)
+	}
+	return bw.Flush()
+}
+
+// exportJSON writes the encoded members between open and close, separated by commas.
+func exportJSON(w *bufio.Writer, open, close byte, members iter.Seq2[[]byte, error]) error {
+	_ = w.WriteByte(open)
+	first := true
+	for member, err := range members {
+		if err != nil {
+			return err
+		}
+		if !first {
+			_ = w.WriteByte(',')
+		}
+		first = false
+		if _, err := w.Write(member); err != nil {
+			return err
+		}
+	}
+	_ = w.WriteByte(close)
+	return w.WriteByte('\n')
+}
+
+// exportCSV writes the header and a row for each element. The key column is written if withKey is set.
+func exportCSV[T any](w io.Writer, withKey bool, elements iter.Seq2[string, T]) error {
+	columns, err := csvColumns(reflect.TypeFor[T](), withKey)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	header := make([]string, 0, len(columns)+1)
+	if withKey {
+		header = append(header, csvKeyColumn)
+	}
+	for _, c := range columns {
+		header = append(header, c.name)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	row := make([]string, len(header))
+	for key, value := range elements {
+		cells := row[:0]
+		if withKey {
+			cells = append(cells, key)
+		}
+		v := reflect.ValueOf(&value).Elem()
+		for _, c := range columns {
+			cell, err := c.encode(v)
+			if err != nil {
+				if withKey {
+					return errors.Join(fmt.Errorf("failed to encode column '%s' of key '%s'", c.name, key), err)
+				}
+				return errors.Join(fmt.Errorf("failed to encode column '%s'", c.name), err)
+			}
+			cells = append(cells, cell)
+		}
+		if err := cw.Write(cells); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportMap reads elements from r in the given format and adds them to m as the mode says.
+// The input is decoded one element at a time. ImportReplace holds the decoded elements until the end,
+// where they replace the data of m at once, so m is left unchanged if the input is invalid.
+// The other modes apply the elements as they are read and keep the ones before an error.
+// It returns the number of elements that were added or replaced.
+// ImportMap locks m by itself, so don't call it while holding the lock.
+func ImportMap[T any](m Map[T], r io.Reader, format Format, mode ImportMode) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+	if follows(m) {
+		return 0, ErrFollower
+	}
+	imp := &mapImporter[T]{m: m, mode: mode}
+	if mode == ImportReplace {
+		imp.replace = make(map[string]T)
+	}
+	var err error
+	switch format {
+	case FormatJSON:
+		dec := json.NewDecoder(bufio.NewReader(r))
+		err = importJSON(dec, '{', func() error {
+			t, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, ok := t.(string)
+			if !ok {
+				return fmt.Errorf("expected a key, got '%v'", t)
+			}
+			var value T
+			if err := dec.Decode(&value); err != nil {
+				return errors.Join(fmt.Errorf("failed to decode value of key '%s'", key), err)
+			}
+			return imp.put(key, value)
+		})
+	case FormatJSONLines:
+		dec := json.NewDecoder(bufio.NewReader(r))
+		for line := 1; err == nil; line++ {
+			var el jsonLinesEl[T]
+			if err = dec.Decode(&el); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+					break
+				}
+				err = errors.Join(fmt.Errorf("failed to decode record %d", line), err)
+				break
+			}
+			if el.Key == nil {
+				err = fmt.Errorf("record %d has no key", line)
+				break
+			}
+			err = imp.put(*el.Key, el.Value)
+		}
+	case FormatCSV:
+		err = importCSV(r, true, imp.put)
+	default:
+		return 0, fmt.Errorf("unsupported format '%s'", format)
+	}
+	if err == nil {
+		err = imp.done()
+	}
+	if err != nil {
+		return imp.n, errors.Join(fmt.Errorf("failed to import map from %s", format), err)
+	}
+	return imp.n, nil
+}
+
+func (imp *mapImporter[T]) put(key string, value T) error {
+	switch imp.mode {
+	case ImportReplace:
+		imp.replace[key] = value
+		return nil
+	case ImportSkipExisting:
+		if imp.m.Has(key) {
+			return nil
+		}
+	}
+	if err := imp.m.Set(key, value); err != nil {
+		return err
+	}
+	imp.n++
+	return nil
+}
+
+func (imp *mapImporter[T]) done() error {
+	if imp.mode != ImportReplace {
+		return nil
+	}
+	if err := imp.m.Overwrite(imp.replace); err != nil {
+		return err
+	}
+	imp.n = len(imp.replace)
+	return nil
+}
+
+// ImportList reads elements from r in the given format and adds them to l as the mode says.
+// ImportSkipExisting compares elements by their JSON encoding.
+// It works like ImportMap otherwise.
+// ImportList locks l by itself, so don't call it while holding the lock.
+func ImportList[T any](l List[T], r io.Reader, format Format, mode ImportMode) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	if follows(l) {
+		return 0, ErrFollower
+	}
+	imp := &listImporter[T]{l: l, mode: mode}
+	switch mode {
+	case ImportReplace:
+		imp.replace = make([]T, 0)
+	case ImportSkipExisting:
+		imp.existing = make(map[string]struct{}, l.Len())
+		for _, value := range l.Query().Collect() {
+			b, err := json.Marshal(value)
+			if err != nil {
+				return 0, errors.Join(errors.New("failed to encode existing element"), err)
+			}
+			imp.existing[string(b)] = struct{}{}
+		}
+	}
+	var err error
+	switch format {
+	case FormatJSON:
+		dec := json.NewDecoder(bufio.NewReader(r))
+		i := 0
+		err = importJSON(dec, '[', func() error {
+			var value T
+			if err := dec.Decode(&value); err != nil {
+				return errors.Join(fmt.Errorf("failed to decode element %d", i), err)
+			}
+			i++
+			return imp.add(value)
+		})
+	case FormatJSONLines:
+		dec := json.NewDecoder(bufio.NewReader(r))
+		for line := 1; ; line++ {
+			var value T
+			if err = dec.Decode(&value); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				} else {
+					err = errors.Join(fmt.Errorf("failed to decode record %d", line), err)
+				}
+				break
+			}
+			if err = imp.add(value); err != nil {
+				err = errors.Join(fmt.Errorf("failed to add record %d", line), err)
+				break
+			}
+		}
+	case FormatCSV:
+		err = importCSV(r, false, func(_ string, value T) error {
+			return imp.add(value)
+		})
+	default:
+		return 0, fmt.Errorf("unsupported format '%s'", format)
+	}
+	if err != nil {
+		return imp.n, errors.Join(fmt.Errorf("failed to import list from %s", format), err)
+	}
+	if mode == ImportReplace {
+		if err := l.Overwrite(imp.replace); err != nil {
+			return 0, errors.Join(fmt.Errorf("failed to import list from %s", format), err)
+		}
+		imp.n = len(imp.replace)
+	}
+	return imp.n, nil
+}
+
+func (imp *listImporter[T]) add(value T) error {
+	switch imp.mode {
+	case ImportReplace:
+		imp.replace = append(imp.replace, value)
+	case ImportSkipExisting:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if _, ok := imp.existing[string(b)]; ok {
+			return nil
+		}
+		imp.existing[string(b)] = struct{}{}
+		if err := imp.l.Append(value); err != nil {
+			return err
+		}
+		imp.n++
+	default:
+		if err := imp.l.Append(value); err != nil {
+			return err
+		}
+		imp.n++
+	}
+	return nil
+}
+
+// importJSON reads a JSON object or array, whose opening delimiter is open, calling member for each member.
+func importJSON(dec *json.Decoder, open json.Delim, member func() error) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != open {
+		return fmt.Errorf("expected '%s', got '%v'", open, t)
+	}
+	for dec.More() {
+		if err := member(); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// importCSV reads the header and calls put for each row.
+// Columns are matched by header name, so their order does not matter and missing columns are left at the zero value.
+// The key column is required if withKey is set.
+func importCSV[T any](r io.Reader, withKey bool, put func(key string, value T) error) error {
+	columns, err := csvColumns(reflect.TypeFor[T](), withKey)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*csvColumn, len(columns))
+	for i := range columns {
+		byName[columns[i].name] = &columns[i]
+	}
+
+	cr := csv.NewReader(bufio.NewReader(r))
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return errors.Join(errors.New("failed to read header"), err)
+	}
+	keyIndex := -1
+	mapped := make([]*csvColumn, len(header))
+	for i, name := range header {
+		if withKey && name == csvKeyColumn {
+			keyIndex = i
+			continue
+		}
+		c, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("unknown column '%s'", name)
+		}
+		mapped[i] = c
+	}
+	if withKey && keyIndex < 0 {
+		return fmt.Errorf("missing column '%s'", csvKeyColumn)
+	}
+
+	for {
+		row, err := cr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+		var value T
+		v := reflect.ValueOf(&value).Elem()
+		key := ""
+		for i, cell := range row {
+			if i == keyIndex {
+				key = cell
+				continue
+			}
+			if err := mapped[i].decode(v, cell); err != nil {
+				return errors.Join(fmt.Errorf("failed to decode column '%s' in line %d", mapped[i].name, line), err)
+			}
+		}
+		if err := put(key, value); err != nil {
+			return err
+		}
+	}
+}
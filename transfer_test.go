@@ -0,0 +1,264 @@
+package speicher
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type (
+	csvLevel int
+
+	csvBase struct {
+		ID      int       `json:"id"`
+		Created time.Time `json:"created"`
+	}
+
+	csvAddress struct {
+		City string `json:"city"`
+		Zip  string `csv:"postcode" json:"zip"`
+	}
+
+	csvUser struct {
+		csvBase
+		Name    string     `json:"name"`
+		Address csvAddress `json:"address"`
+		Level   csvLevel   `json:"level"`
+		Tags    []string   `json:"tags"`
+		Note    *string    `json:"note"`
+		Secret  string     `json:"-"`
+	}
+)
+
+func (l csvLevel) MarshalText() ([]byte, error) {
+	switch l {
+	case 1:
+		return []byte("admin"), nil
+	case 2:
+		return []byte("guest"), nil
+	}
+	return nil, errors.New("unknown level")
+}
+
+func (l *csvLevel) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "admin":
+		*l = 1
+	case "guest":
+		*l = 2
+	default:
+		return errors.New("unknown level")
+	}
+	return nil
+}
+
+func csvUsers() []csvUser {
+	note := "likes, commas"
+	return []csvUser{
+		{
+			csvBase: csvBase{ID: 1, Created: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)},
+			Name:    "Ada",
+			Address: csvAddress{City: "London", Zip: "N1"},
+			Level:   1,
+			Tags:    []string{"a", "b"},
+			Note:    &note,
+		},
+		{
+			csvBase: csvBase{ID: 2, Created: time.Date(2024, 6, 2, 8, 0, 0, 0, time.UTC)},
+			Name:    "Grace \"Amazing\"",
+			Address: csvAddress{City: "New York"},
+			Level:   2,
+		},
+	}
+}
+
+// csvHeader returns the header row of a CSV export.
+func csvHeader(t *testing.T, b []byte) []string {
+	t.Helper()
+	header, err := csv.NewReader(bytes.NewReader(b)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestCSVColumns(t *testing.T) {
+	columns, err := csvColumns(reflect.TypeFor[csvUser](), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range columns {
+		names = append(names, c.name)
+	}
+	want := []string{"id", "created", "name", "address.city", "address.postcode", "level", "tags", "note"}
+	if !slices.Equal(names, want) {
+		t.Errorf("columns are %v, want %v", names, want)
+	}
+
+	type keyed struct {
+		Key string `json:"key"`
+	}
+	if _, err := csvColumns(reflect.TypeFor[keyed](), true); err == nil {
+		t.Error("a field named key is accepted for a Map")
+	}
+}
+
+func TestCSVRoundTripMap(t *testing.T) {
+	dir := t.TempDir()
+	src, err := LoadMap[csvUser](filepath.Join(dir, "src.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := csvUsers()
+	users[0].Secret = "not exported"
+	src.Lock()
+	for _, u := range users {
+		_ = src.Set(u.Name, u)
+	}
+	src.Unlock()
+
+	var buf bytes.Buffer
+	if err := ExportMap(src, &buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	if header := csvHeader(t, buf.Bytes()); header[0] != "key" || slices.Contains(header, "Secret") {
+		t.Errorf("unexpected header %v", header)
+	}
+
+	dst, err := LoadMap[csvUser](filepath.Join(dir, "dst.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := ImportMap(dst, &buf, FormatCSV, ImportReplace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(users) {
+		t.Errorf("imported %d elements, want %d", n, len(users))
+	}
+	users[0].Secret = ""
+	dst.RLock()
+	defer dst.RUnlock()
+	for _, want := range users {
+		got, ok := dst.Get(want.Name)
+		if !ok {
+			t.Errorf("key '%s' is missing", want.Name)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("key '%s' is %+v, want %+v", want.Name, got, want)
+		}
+	}
+}
+
+func TestCSVRoundTripPointerList(t *testing.T) {
+	dir := t.TempDir()
+	src, err := LoadList[*csvUser](filepath.Join(dir, "src.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := csvUsers()
+	src.Lock()
+	for i := range users {
+		src.Append(&users[i])
+	}
+	src.Append(nil)
+	src.Unlock()
+
+	var buf bytes.Buffer
+	if err := ExportList(src, &buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	if header := csvHeader(t, buf.Bytes()); header[0] != "id" {
+		t.Errorf("unexpected header %v", header)
+	}
+
+	dst, err := LoadList[*csvUser](filepath.Join(dir, "dst.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ImportList(dst, &buf, FormatCSV, ImportMerge); err != nil {
+		t.Fatal(err)
+	}
+	dst.RLock()
+	defer dst.RUnlock()
+	got := dst.Query().Collect()
+	if len(got) != len(users)+1 {
+		t.Fatalf("imported %d elements, want %d", len(got), len(users)+1)
+	}
+	for i, want := range users {
+		if got[i] == nil || !reflect.DeepEqual(*got[i], want) {
+			t.Errorf("element %d is %+v, want %+v", i, got[i], want)
+		}
+	}
+	if got[len(users)] != nil {
+		t.Errorf("nil element was imported as %+v", got[len(users)])
+	}
+}
+
+func TestCSVRoundTripScalarList(t *testing.T) {
+	dir := t.TempDir()
+	src, err := LoadList[time.Time](filepath.Join(dir, "src.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := []time.Time{
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 2, 3, 4, 5, 6, 7, time.UTC),
+	}
+	src.Lock()
+	src.Overwrite(slices.Clone(times))
+	src.Unlock()
+
+	var buf bytes.Buffer
+	if err := ExportList(src, &buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "value\n") {
+		t.Errorf("unexpected export %q", buf.String())
+	}
+
+	dst, err := LoadList[time.Time](filepath.Join(dir, "dst.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ImportList(dst, &buf, FormatCSV, ImportMerge); err != nil {
+		t.Fatal(err)
+	}
+	dst.RLock()
+	defer dst.RUnlock()
+	if got := dst.Query().Collect(); !reflect.DeepEqual(got, times) {
+		t.Errorf("imported %v, want %v", got, times)
+	}
+}
+
+func TestImportListSkipExisting(t *testing.T) {
+	l, err := LoadList[csvAddress](filepath.Join(t.TempDir(), "list.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Lock()
+	l.Append(csvAddress{City: "Paris"})
+	l.Unlock()
+
+	input := `[{"city":"Paris"},{"city":"Rome"},{"city":"Rome"}]`
+	n, err := ImportList(l, strings.NewReader(input), FormatJSON, ImportSkipExisting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("imported %d elements, want 1", n)
+	}
+	l.RLock()
+	defer l.RUnlock()
+	if got := l.Len(); got != 2 {
+		t.Errorf("list has %d elements, want 2", got)
+	}
+}
@@ -0,0 +1,178 @@
+package speicher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// janitorInterval is how often the janitor of a Map looks for expired elements.
+const janitorInterval = time.Minute
+
+// expiresLocation returns the location of the file that holds the expiration times of a map stored at location.
+func expiresLocation(location string) string {
+	return strings.TrimSuffix(location, filepath.Ext(location)) + ".expires.json"
+}
+
+// expired reports whether the element with the given key has expired.
+func (m *memoryMap[T]) expired(key string, now time.Time) bool {
+	if len(m.expires) == 0 {
+		return false
+	}
+	at, ok := m.expires[key]
+	return ok && !at.After(now)
+}
+
+// live reports whether key exists and has not expired.
+func (m *memoryMap[T]) live(key string) bool {
+	return m.data.has(key) && !m.expired(key, time.Now())
+}
+
+func (m *memoryMap[T]) SetWithTTL(key string, value T, ttl time.Duration) error {
+	if err := m.Set(key, value); err != nil {
+		return err
+	}
+	m.expire(key, time.Now().Add(ttl))
+	return nil
+}
+
+func (m *memoryMap[T]) Expire(key string, at time.Time) (bool, error) {
+	if m.follower {
+		return false, ErrFollower
+	}
+	if !m.live(key) {
+		return false, nil
+	}
+	m.expire(key, at)
+	return true, nil
+}
+
+func (m *memoryMap[T]) Persist(key string) (bool, error) {
+	if m.follower {
+		return false, ErrFollower
+	}
+	if !m.live(key) {
+		return false, nil
+	}
+	if _, ok := m.expires[key]; !ok {
+		return false, nil
+	}
+	delete(m.expires, key)
+	if m.primary != nil {
+		m.primary.record(replChange{Op: opExpire, Key: key})
+	}
+	return true, nil
+}
+
+func (m *memoryMap[T]) ExpiresAt(key string) (time.Time, bool) {
+	if !m.live(key) {
+		return time.Time{}, false
+	}
+	at, ok := m.expires[key]
+	return at, ok
+}
+
+func (m *memoryMap[T]) expire(key string, at time.Time) {
+	if m.expires == nil {
+		m.expires = make(map[string]time.Time)
+	}
+	m.expires[key] = at
+	m.startJanitor()
+	if m.primary != nil {
+		m.primary.record(replChange{Op: opExpire, Key: key, At: &at})
+	}
+}
+
+func (m *memoryMap[T]) startJanitor() {
+	m.janitor.Do(func() {
+		m.stopJanitor = make(chan struct{})
+		go m.runJanitor(m.stopJanitor)
+	})
+}
+
+func (m *memoryMap[T]) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		// after this, startJanitor does nothing and stopJanitor is set if the janitor runs
+		m.janitor.Do(func() {})
+		if m.stopJanitor != nil {
+			close(m.stopJanitor)
+		}
+		err = errors.Join(m.data.close(), m.lock.Release())
+	})
+	return err
+}
+
+// runJanitor periodically deletes expired elements until stop is closed.
+// Deleting happens under the write lock, so it triggers the normal save.
+func (m *memoryMap[T]) runJanitor(stop <-chan struct{}) {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		m.RLock()
+		found := m.hasExpired(time.Now())
+		m.RUnlock()
+		if !found {
+			continue
+		}
+		m.Lock()
+		m.removeExpired(time.Now())
+		m.Unlock()
+	}
+}
+
+func (m *memoryMap[T]) hasExpired(now time.Time) bool {
+	for key := range m.expires {
+		if m.expired(key, now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryMap[T]) removeExpired(now time.Time) {
+	for key := range m.expires {
+		if m.expired(key, now) {
+			m.remove(key)
+		}
+	}
+}
+
+// saveExpires writes the expiration times next to the data file.
+// If there are none, the file is removed.
+func (m *memoryMap[T]) saveExpires() error {
+	location := expiresLocation(m.location)
+	if len(m.expires) == 0 {
+		if err := os.Remove(location); err != nil && !os.IsNotExist(err) {
+			return errors.Join(fmt.Errorf("failed to remove file '%s'", location), err)
+		}
+		return nil
+	}
+	return saveJsonFile(location, m.expires)
+}
+
+func (m *memoryMap[T]) loadExpires() error {
+	found, err := loadJsonFile(expiresLocation(m.location), &m.expires)
+	if err != nil || !found {
+		return err
+	}
+	// the expiration times are saved before the data, so they may refer to elements that were never saved
+	for key := range m.expires {
+		if !m.data.has(key) {
+			delete(m.expires, key)
+		}
+	}
+	if len(m.expires) == 0 {
+		return nil
+	}
+	m.startJanitor()
+	return nil
+}
@@ -0,0 +1,117 @@
+package speicher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type (
+	// memoryValue is a Value implementation that keeps the document in memory.
+	memoryValue[T any] struct {
+		data     T
+		location string
+		mut      sync.RWMutex
+
+		saveState
+	}
+
+	// Value is a thread-safe data store interface for a single document,
+	// like the settings of a service.
+	Value[T any] interface {
+		// Get returns the stored document.
+		Get() T
+
+		// Set replaces the stored document.
+		Set(value T)
+
+		// Update calls f with a pointer to the stored document so it can be modified in place.
+		Update(f func(*T))
+
+		// Save persists the current state of the Value to its underlying data store.
+		// It returns an error if the operation fails.
+		Save() error
+
+		// Lock acquires the write lock for the data store to allow safe updates.
+		// Don't forget to use Unlock when you are done.
+		Lock()
+
+		// Unlock releases the write lock for the data store.
+		Unlock()
+
+		// RLock acquires the read lock for the data store to allow safe reading.
+		// Don't forget to use RUnlock when you are done.
+		RLock()
+
+		// RUnlock releases the read lock for the data store.
+		RUnlock()
+	}
+)
+
+func (v *memoryValue[T]) Get() T {
+	return v.data
+}
+
+func (v *memoryValue[T]) Set(value T) {
+	v.data = value
+}
+
+func (v *memoryValue[T]) Update(f func(*T)) {
+	f(&v.data)
+}
+
+func (v *memoryValue[T]) Lock() {
+	v.mut.Lock()
+}
+
+func (v *memoryValue[T]) Unlock() {
+	v.mut.Unlock()
+	notifyChanged(v)
+}
+
+func (v *memoryValue[T]) RLock() {
+	v.mut.RLock()
+}
+
+func (v *memoryValue[T]) RUnlock() {
+	v.mut.RUnlock()
+}
+
+func (v *memoryValue[T]) Save() error {
+	v.RLock()
+	defer v.RUnlock()
+
+	return saveFile(v.location, codecOf(v.location), v.data)
+}
+
+// LoadValue loads the Value stored at location.
+// If the file does not exist, the Value holds def.
+// If the file exists, it is decoded on top of def, so fields missing in the file keep their default.
+// The Value works on a copy of def made with the Codec of location, so def itself is never changed,
+// even if T is a pointer; fields the Codec does not store, like unexported ones, are not copied.
+func LoadValue[T any](location string, def T) (Value[T], error) {
+	if c, ok := codecFor(location); ok {
+		if v, err := loadValueFromFile(location, c, def); err != nil {
+			return nil, errors.Join(fmt.Errorf("unable to load value from file '%s'", location), err)
+		} else {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to find loader for '%s'", location)
+}
+
+func loadValueFromFile[T any](location string, c Codec, def T) (Value[T], error) {
+	v := &memoryValue[T]{location: location}
+	var buf bytes.Buffer
+	if err := c.Encode(&buf, def); err != nil {
+		return nil, errors.Join(errors.New("failed to copy default"), err)
+	}
+	if err := c.Decode(&buf, &v.data); err != nil {
+		return nil, errors.Join(errors.New("failed to copy default"), err)
+	}
+	if _, err := loadFile(location, c, &v.data); err != nil {
+		return nil, err
+	}
+	return v, nil
+}